@@ -0,0 +1,146 @@
+package goetty
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// AdmissionController decides whether the accepted connection can be used to create a
+// session. It is called in the accept loop before the session created, so it must not
+// block.
+type AdmissionController interface {
+	// Admit returns true to accept the connection. If returns false, the connection is
+	// rejected and closed, and the message is written to the connection before closed if
+	// not empty.
+	Admit(conn net.Conn) (bool, []byte)
+}
+
+// AdmissionControllerFunc is an adapter to allow the use of ordinary functions as
+// AdmissionController.
+type AdmissionControllerFunc func(conn net.Conn) (bool, []byte)
+
+// Admit calls f(conn)
+func (f AdmissionControllerFunc) Admit(conn net.Conn) (bool, []byte) {
+	return f(conn)
+}
+
+// connLimiter limits the number of the concurrent connections in total and per remote IP.
+// Connections without an IP address, e.g. unix socket, are only limited by the total.
+type connLimiter struct {
+	maxConnections      int
+	maxConnectionsPerIP int
+
+	mu struct {
+		sync.Mutex
+		total int
+		perIP map[string]int
+	}
+}
+
+func newConnLimiter(maxConnections, maxConnectionsPerIP int) *connLimiter {
+	l := &connLimiter{
+		maxConnections:      maxConnections,
+		maxConnectionsPerIP: maxConnectionsPerIP,
+	}
+	l.mu.perIP = make(map[string]int)
+	return l
+}
+
+// acquire returns false if the connection exceeds the limits
+func (l *connLimiter) acquire(conn net.Conn) bool {
+	ip := remoteIP(conn)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.maxConnections > 0 && l.mu.total >= l.maxConnections {
+		return false
+	}
+	if ip != "" && l.maxConnectionsPerIP > 0 && l.mu.perIP[ip] >= l.maxConnectionsPerIP {
+		return false
+	}
+
+	l.mu.total++
+	if ip != "" {
+		l.mu.perIP[ip]++
+	}
+	return true
+}
+
+// release releases the connection acquired before
+func (l *connLimiter) release(conn net.Conn) {
+	ip := remoteIP(conn)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.mu.total--
+	if ip != "" {
+		if n := l.mu.perIP[ip] - 1; n > 0 {
+			l.mu.perIP[ip] = n
+		} else {
+			delete(l.mu.perIP, ip)
+		}
+	}
+}
+
+// remoteIP returns the remote ip of the conn, or empty if it is not an ip address
+func remoteIP(conn net.Conn) string {
+	switch addr := conn.RemoteAddr().(type) {
+	case *net.TCPAddr:
+		return addr.IP.String()
+	case *net.UDPAddr:
+		return addr.IP.String()
+	}
+	return ""
+}
+
+// rejectConn closes the conn. If the message is not empty, the message is written to the
+// conn before closed in a new goroutine, because the TLS handshake or the write may be
+// blocked by the peer, which must not block the accept loop.
+func rejectConn(logger *zap.Logger, conn net.Conn, reason string, message []byte) {
+	logger.Info("connection rejected",
+		zap.String("addr", conn.RemoteAddr().String()),
+		zap.String("reason", reason))
+
+	if len(message) == 0 {
+		closeRejectedConn(logger, conn)
+		return
+	}
+	go func() {
+		defer closeRejectedConn(logger, conn)
+		if err := writeRejectMessage(conn, message); err != nil {
+			logger.Debug("write reject message failed",
+				zap.String("addr", conn.RemoteAddr().String()),
+				zap.Error(err))
+		}
+	}()
+}
+
+// writeRejectMessage writes the message to the conn, the TLS handshake and the write must
+// be completed in defaultRejectWriteTimeout.
+func writeRejectMessage(conn net.Conn, message []byte) error {
+	deadline := time.Now().Add(defaultRejectWriteTimeout)
+	if err := conn.SetDeadline(deadline); err != nil {
+		return err
+	}
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		ctx, cancel := context.WithDeadline(context.Background(), deadline)
+		defer cancel()
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			return err
+		}
+	}
+	_, err := conn.Write(message)
+	return err
+}
+
+func closeRejectedConn(logger *zap.Logger, conn net.Conn) {
+	if err := conn.Close(); err != nil {
+		logger.Error("close rejected connection failed",
+			zap.Error(err))
+	}
+}
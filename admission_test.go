@@ -0,0 +1,174 @@
+package goetty
+
+import (
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lni/goutils/leaktest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaxConnections(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	for name, address := range testAddresses {
+		addr := address
+		t.Run(name, func(t *testing.T) {
+			app := newTestApp(t,
+				testListenAddresses,
+				func(i IOSession[string, string], a string, u uint64) error {
+					return i.Write(a, WriteOptions{Flush: true})
+				},
+				WithAppMaxConnections[string, string](1))
+			assert.NoError(t, app.Start())
+			defer app.Stop()
+
+			s1 := newTestIOSession(t)
+			assert.NoError(t, s1.Connect(addr, time.Second))
+			assertTestEcho(t, s1)
+
+			s2 := newTestIOSession(t)
+			defer s2.Close()
+			assert.NoError(t, s2.Connect(addr, time.Second))
+			_, err := s2.Read(ReadOptions{Timeout: time.Second})
+			assert.Error(t, err)
+			assert.Equal(t, uint64(1), app.RejectedConnections())
+
+			// the slot is released after the first session closed
+			assert.NoError(t, s1.Close())
+			assert.Eventually(t, func() bool {
+				l := app.(*server[string, string]).limiter
+				l.mu.Lock()
+				defer l.mu.Unlock()
+				return l.mu.total == 0
+			}, time.Second, time.Millisecond*10)
+			s3 := newTestIOSession(t)
+			defer s3.Close()
+			assert.NoError(t, s3.Connect(addr, time.Second))
+			assertTestEcho(t, s3)
+		})
+	}
+}
+
+func TestMaxConnectionsPerIP(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	app := newTestApp(t,
+		testListenAddresses,
+		func(i IOSession[string, string], a string, u uint64) error {
+			return i.Write(a, WriteOptions{Flush: true})
+		},
+		WithAppMaxConnectionsPerIP[string, string](1))
+	assert.NoError(t, app.Start())
+	defer app.Stop()
+
+	s1 := newTestIOSession(t)
+	defer s1.Close()
+	assert.NoError(t, s1.Connect(testAddr, time.Second))
+	assertTestEcho(t, s1)
+
+	s2 := newTestIOSession(t)
+	defer s2.Close()
+	assert.NoError(t, s2.Connect(testAddr, time.Second))
+	_, err := s2.Read(ReadOptions{Timeout: time.Second})
+	assert.Error(t, err)
+	assert.Equal(t, uint64(1), app.RejectedConnections())
+
+	// unix socket connections have no remote ip
+	for i := 0; i < 2; i++ {
+		s := newTestIOSession(t)
+		assert.NoError(t, s.Connect(testUnixSocket, time.Second))
+		assertTestEcho(t, s)
+		assert.NoError(t, s.Close())
+	}
+	assert.Equal(t, uint64(1), app.RejectedConnections())
+}
+
+func TestAdmissionController(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	reject := int32(1)
+	app := newTestApp(t,
+		[]string{testAddr},
+		func(i IOSession[string, string], a string, u uint64) error {
+			return i.Write(a, WriteOptions{Flush: true})
+		},
+		WithAppAdmissionController[string, string](AdmissionControllerFunc(func(conn net.Conn) (bool, []byte) {
+			if atomic.LoadInt32(&reject) == 1 {
+				return false, []byte("busy")
+			}
+			return true, nil
+		})))
+	assert.NoError(t, app.Start())
+	defer app.Stop()
+
+	conn, err := net.Dial("tcp", testAddr)
+	assert.NoError(t, err)
+	assert.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	data, err := io.ReadAll(conn)
+	assert.NoError(t, err)
+	assert.Equal(t, "busy", string(data))
+	assert.NoError(t, conn.Close())
+	assert.Equal(t, uint64(1), app.RejectedConnections())
+
+	atomic.StoreInt32(&reject, 0)
+	s := newTestIOSession(t)
+	defer s.Close()
+	assert.NoError(t, s.Connect(testAddr, time.Second))
+	assertTestEcho(t, s)
+	assert.Equal(t, uint64(1), app.RejectedConnections())
+}
+
+func TestAdmissionRejectNotBlockedBySilentTLSClient(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	app := newTestApp(t,
+		[]string{testAddr},
+		nil,
+		WithAppTLSFromCertAndKey[string, string](
+			"./etc/server-cert.pem",
+			"./etc/server-key.pem",
+			"./etc/ca.pem",
+			true),
+		WithAppAdmissionController[string, string](AdmissionControllerFunc(func(conn net.Conn) (bool, []byte) {
+			return false, []byte("busy")
+		})))
+	assert.NoError(t, app.Start())
+	defer app.Stop()
+
+	// the silent client never starts the TLS handshake
+	silent, err := net.Dial("tcp", testAddr)
+	assert.NoError(t, err)
+	defer silent.Close()
+
+	rs := newTestIOSession(t,
+		WithSessionTLSFromCertAndKeys[string, string](
+			"./etc/client-cert.pem",
+			"./etc/client-key.pem",
+			"./etc/ca.pem",
+			true))
+	defer rs.Close()
+	assert.NoError(t, rs.Connect(testAddr, time.Second))
+	conn := rs.RawConn()
+	assert.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Millisecond*500)))
+	data, err := io.ReadAll(conn)
+	assert.NoError(t, err)
+	assert.Equal(t, "busy", string(data))
+
+	// the silent client is closed after the reject timeout
+	assert.NoError(t, silent.SetReadDeadline(time.Now().Add(defaultRejectWriteTimeout*2)))
+	_, err = silent.Read(make([]byte, 1))
+	assert.Error(t, err)
+	assert.False(t, isTimeoutErr(err))
+	assert.Equal(t, uint64(2), app.RejectedConnections())
+}
+
+func assertTestEcho(t *testing.T, rs IOSession[string, string]) {
+	assert.NoError(t, rs.Write("hello", WriteOptions{Flush: true}))
+	reply, err := rs.Read(ReadOptions{Timeout: time.Second})
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", reply)
+}
@@ -48,6 +48,135 @@ func WithAppSessionAware[IN any, OUT any](value IOSessionAware[IN, OUT]) AppOpti
 	}
 }
 
+// WithAppIdleTimeout set the idle timeouts for sessions. An IdleState event is fired when no
+// data was read, written or both for the timeout, 0 means disabled. The session is closed on
+// idle, unless a IOSessionIdleAware is set by WithAppSessionIdleAware to decide.
+func WithAppIdleTimeout[IN any, OUT any](readIdle, writeIdle, allIdle time.Duration) AppOption[IN, OUT] {
+	return func(s *server[IN, OUT]) {
+		s.options.readIdleTimeout = readIdle
+		s.options.writeIdleTimeout = writeIdle
+		s.options.allIdleTimeout = allIdle
+	}
+}
+
+// WithAppSessionIdleAware set the app session idle aware
+func WithAppSessionIdleAware[IN any, OUT any](value IOSessionIdleAware[IN, OUT]) AppOption[IN, OUT] {
+	return func(s *server[IN, OUT]) {
+		s.options.idleAware = value
+	}
+}
+
+// WithAppShutdownHook set a func to be called for each active session when Shutdown, which
+// can be used to notify the peer that the server is going away, e.g. send a GOAWAY message.
+func WithAppShutdownHook[IN any, OUT any](value func(IOSession[IN, OUT]) error) AppOption[IN, OUT] {
+	return func(s *server[IN, OUT]) {
+		s.options.shutdownHook = value
+	}
+}
+
+// WithAppMaxConnections set the max number of the concurrent sessions, the new connections
+// are rejected when exceeded, 0 means no limit.
+func WithAppMaxConnections[IN any, OUT any](value int) AppOption[IN, OUT] {
+	return func(s *server[IN, OUT]) {
+		s.options.maxConnections = value
+	}
+}
+
+// WithAppMaxConnectionsPerIP set the max number of the concurrent sessions from the same
+// remote IP, the new connections are rejected when exceeded, 0 means no limit.
+func WithAppMaxConnectionsPerIP[IN any, OUT any](value int) AppOption[IN, OUT] {
+	return func(s *server[IN, OUT]) {
+		s.options.maxConnectionsPerIP = value
+	}
+}
+
+// WithAppAdmissionController set the AdmissionController to decide whether the accepted
+// connection can be used to create a session.
+func WithAppAdmissionController[IN any, OUT any](value AdmissionController) AppOption[IN, OUT] {
+	return func(s *server[IN, OUT]) {
+		s.options.admission = value
+	}
+}
+
+// WithAppIPFilter set the IPFilter to reject the connections from the not allowed remote IPs,
+// the connections accepted by the unix socket listeners are not filtered.
+func WithAppIPFilter[IN any, OUT any](value *IPFilter) AppOption[IN, OUT] {
+	return func(s *server[IN, OUT]) {
+		s.options.ipFilter = value
+	}
+}
+
+// WithAppBroadcast set the max number of sessions written concurrently and the write
+// timeout of each session for Broadcast, 0 timeout means no timeout.
+func WithAppBroadcast[IN any, OUT any](concurrency int, timeout time.Duration) AppOption[IN, OUT] {
+	return func(s *server[IN, OUT]) {
+		s.options.broadcastConcurrency = concurrency
+		s.options.broadcastTimeout = timeout
+	}
+}
+
+// WithAppInboundInterceptors add interceptors for the messages received by all sessions, they
+// are called in the order added before the session level inbound interceptors and the
+// handleFunc. They are not used if the handleSessionFunc is set.
+func WithAppInboundInterceptors[IN any, OUT any](interceptors ...InboundInterceptor[IN, OUT]) AppOption[IN, OUT] {
+	return func(s *server[IN, OUT]) {
+		s.options.inboundInterceptors = append(s.options.inboundInterceptors, interceptors...)
+	}
+}
+
+// WithAppOutboundInterceptors add interceptors for the messages written by all sessions, they
+// are called in the order added after the session level outbound interceptors.
+func WithAppOutboundInterceptors[IN any, OUT any](interceptors ...OutboundInterceptor[IN, OUT]) AppOption[IN, OUT] {
+	return func(s *server[IN, OUT]) {
+		s.options.outboundInterceptors = append(s.options.outboundInterceptors, interceptors...)
+	}
+}
+
+// WithAppSessionInterceptors set a func to build the interceptors of each accepted session, the
+// func is called once the session created, so the chains can depend on the session, e.g. the
+// remote address. The inbound interceptors are called after the session level inbound
+// interceptors, and the outbound interceptors are called after the session level outbound
+// interceptors and before the application level outbound interceptors. The inbound
+// interceptors are not used if the handleSessionFunc is set.
+func WithAppSessionInterceptors[IN any, OUT any](value func(IOSession[IN, OUT]) ([]InboundInterceptor[IN, OUT], []OutboundInterceptor[IN, OUT])) AppOption[IN, OUT] {
+	return func(s *server[IN, OUT]) {
+		s.options.sessionInterceptors = value
+	}
+}
+
+// WithAppErrorPolicy set the ErrorPolicy to handle the panics and errors of the sessions
+func WithAppErrorPolicy[IN any, OUT any](value ErrorPolicy[IN, OUT]) AppOption[IN, OUT] {
+	return func(s *server[IN, OUT]) {
+		s.options.errorPolicy = value
+	}
+}
+
+// WithAppWorkerPool set the worker pool to handle the messages of all sessions instead of
+// handling in the read goroutine of each session. It is not used if the handleSessionFunc
+// is set. BackpressureBlock is not used by the sessions driven by the event loop, see
+// WithAppEventLoop.
+func WithAppWorkerPool[IN any, OUT any](cfg WorkerPoolConfig) AppOption[IN, OUT] {
+	return func(s *server[IN, OUT]) {
+		s.options.workerPool = &cfg
+	}
+}
+
+// WithAppEventLoop handles the sessions by n epoll based event loops instead of a goroutine
+// per session, 0 means the number of CPUs. The event loop reads the data only when the
+// connection is readable, and calls the handleFunc in the event loop goroutine unless the
+// worker pool is set, so the handleFunc should not block. If the worker pool is set with
+// BackpressureBlock, the sessions are closed once the worker queue is full instead of
+// blocking the event loop. The buffers of the sessions are only allocated to hold the
+// incomplete messages and the unflushed data, so the idle sessions hold almost no memory.
+// The tls connections, and the platforms other than linux, fallback to a goroutine per
+// session. It is not used if the handleSessionFunc is set.
+func WithAppEventLoop[IN any, OUT any](n int) AppOption[IN, OUT] {
+	return func(s *server[IN, OUT]) {
+		s.options.eventLoop = true
+		s.options.eventLoops = n
+	}
+}
+
 // WithAppSessionOptions set options to create new connection
 func WithAppSessionOptions[IN any, OUT any](options ...Option[IN, OUT]) AppOption[IN, OUT] {
 	return func(s *server[IN, OUT]) {
@@ -58,9 +187,7 @@ func WithAppSessionOptions[IN any, OUT any](options ...Option[IN, OUT]) AppOptio
 // WithAppTLS set tls config for application
 func WithAppTLS[IN any, OUT any](tlsCfg *tls.Config) AppOption[IN, OUT] {
 	return func(s *server[IN, OUT]) {
-		for idx, listener := range s.listeners {
-			s.listeners[idx] = tls.NewListener(listener, tlsCfg)
-		}
+		s.options.tlsConfig = tlsCfg
 	}
 }
 
@@ -88,13 +215,11 @@ func WithAppTLSFromCertAndKey[IN any, OUT any](
 			}
 		}
 
-		for idx, listener := range s.listeners {
-			s.listeners[idx] = tls.NewListener(listener, &tls.Config{
-				Certificates:       []tls.Certificate{cert},
-				InsecureSkipVerify: insecureSkipVerify,
-				ClientAuth:         tls.RequireAndVerifyClientCert,
-				ClientCAs:          caPool,
-			})
+		s.options.tlsConfig = &tls.Config{
+			Certificates:       []tls.Certificate{cert},
+			InsecureSkipVerify: insecureSkipVerify,
+			ClientAuth:         tls.RequireAndVerifyClientCert,
+			ClientCAs:          caPool,
 		}
 	}
 }
@@ -105,8 +230,31 @@ type NetApplication[IN any, OUT any] interface {
 	Start() error
 	// Stop stop the transport server
 	Stop() error
+	// Shutdown gracefully stop the transport server. It stops accepting new connections,
+	// calls the shutdown hook for each active session, and waits for the sessions to be
+	// closed until the ctx done, then force closes the remaining sessions.
+	Shutdown(ctx context.Context) (ShutdownStats, error)
+	// RejectedConnections returns the number of the connections rejected by the IPFilter, the
+	// connection limits or the AdmissionController
+	RejectedConnections() uint64
 	// GetSession get session
 	GetSession(uint64) (IOSession[IN, OUT], error)
+	// Range calls fn for each active session, stops the iteration if fn returns false
+	Range(fn func(IOSession[IN, OUT]) bool)
+	// Count returns the number of active sessions
+	Count() int
+	// Broadcast writes and flushes the msg to the active sessions matched by the filter
+	// concurrently, nil filter matches all sessions. Returns the errors of the failed
+	// sessions keyed by session id.
+	Broadcast(msg OUT, filter func(IOSession[IN, OUT]) bool) map[uint64]error
+}
+
+// ShutdownStats the result of the Shutdown
+type ShutdownStats struct {
+	// Drained the number of sessions closed before the ctx done
+	Drained int
+	// Forced the number of sessions force closed after the ctx done
+	Forced int
 }
 
 type sessionMap[IN any, OUT any] struct {
@@ -118,23 +266,50 @@ type server[IN any, OUT any] struct {
 	logger     *zap.Logger
 	listeners  []net.Listener
 	wg         sync.WaitGroup
+	handlers   sync.WaitGroup
 	sessions   map[uint64]*sessionMap[IN, OUT]
 	handleFunc func(IOSession[IN, OUT], IN, uint64) error
+	idle       *idleChecker[IN, OUT]
+	limiter    *connLimiter
+	workers    *workerPool[IN, OUT]
+	loops      *eventLoops[IN, OUT]
 
 	mu struct {
 		sync.RWMutex
-		running bool
+		running  bool
+		stopping bool
 	}
 
 	atomic struct {
-		id uint64
+		id       uint64
+		rejected uint64
 	}
 
 	options struct {
-		sessionOpts       []Option[IN, OUT]
-		sessionBucketSize uint64
-		aware             IOSessionAware[IN, OUT]
-		handleSessionFunc func(IOSession[IN, OUT]) error
+		sessionOpts          []Option[IN, OUT]
+		sessionBucketSize    uint64
+		aware                IOSessionAware[IN, OUT]
+		handleSessionFunc    func(IOSession[IN, OUT]) error
+		readIdleTimeout      time.Duration
+		writeIdleTimeout     time.Duration
+		allIdleTimeout       time.Duration
+		idleAware            IOSessionIdleAware[IN, OUT]
+		shutdownHook         func(IOSession[IN, OUT]) error
+		maxConnections       int
+		maxConnectionsPerIP  int
+		admission            AdmissionController
+		ipFilter             *IPFilter
+		broadcastConcurrency int
+		broadcastTimeout     time.Duration
+		inboundInterceptors  []InboundInterceptor[IN, OUT]
+		outboundInterceptors []OutboundInterceptor[IN, OUT]
+		sessionInterceptors  func(IOSession[IN, OUT]) ([]InboundInterceptor[IN, OUT], []OutboundInterceptor[IN, OUT])
+		errorPolicy          ErrorPolicy[IN, OUT]
+		workerPool           *WorkerPoolConfig
+		eventLoop            bool
+		eventLoops           int
+		tlsConfig            *tls.Config
+		proxyProtocol        *ProxyProtocolConfig
 	}
 }
 
@@ -163,12 +338,46 @@ func NewApplicationWithListeners[IN any, OUT any](
 	}
 	addresses += "]"
 	s.logger = s.logger.With(zap.String("listen-addresses", addresses))
+	// the PROXY protocol header is sent before the TLS handshake
+	for idx, listener := range s.listeners {
+		if s.options.proxyProtocol != nil {
+			listener = newProxyProtocolListener(listener, *s.options.proxyProtocol,
+				s.logger.Named("proxy-protocol"))
+		}
+		if s.options.tlsConfig != nil {
+			listener = tls.NewListener(listener, s.options.tlsConfig)
+		}
+		s.listeners[idx] = listener
+	}
 	s.sessions = make(map[uint64]*sessionMap[IN, OUT], s.options.sessionBucketSize)
 	for i := uint64(0); i < s.options.sessionBucketSize; i++ {
 		s.sessions[i] = &sessionMap[IN, OUT]{
 			sessions: make(map[uint64]IOSession[IN, OUT]),
 		}
 	}
+	if s.options.readIdleTimeout > 0 ||
+		s.options.writeIdleTimeout > 0 ||
+		s.options.allIdleTimeout > 0 {
+		s.idle = newIdleChecker(s)
+	}
+	if s.options.maxConnections > 0 ||
+		s.options.maxConnectionsPerIP > 0 {
+		s.limiter = newConnLimiter(s.options.maxConnections, s.options.maxConnectionsPerIP)
+	}
+	if s.options.workerPool != nil &&
+		s.options.handleSessionFunc == nil {
+		s.workers = newWorkerPool(s, *s.options.workerPool)
+	}
+	if s.options.eventLoop &&
+		s.options.handleSessionFunc == nil {
+		loops, err := newEventLoops(s, s.options.eventLoops)
+		if err == errEventLoopNotSupported {
+			s.logger.Warn("event loop is not supported, fallback to goroutine per session")
+		} else if err != nil {
+			return nil, err
+		}
+		s.loops = loops
+	}
 	return s, nil
 }
 
@@ -229,20 +438,112 @@ func (s *server[IN, OUT]) Start() error {
 	}
 
 	s.mu.running = true
+	if s.workers != nil {
+		s.workers.start()
+	}
+	if s.loops != nil {
+		s.loops.start()
+	}
 	s.doStart()
+	if s.idle != nil {
+		s.idle.start()
+	}
 	s.logger.Debug("application started")
 	return nil
 }
 
 func (s *server[IN, OUT]) Stop() error {
 	s.mu.Lock()
-	if !s.mu.running {
+	if !s.mu.running || s.mu.stopping {
 		s.mu.Unlock()
 		return nil
 	}
 	s.mu.running = false
 	s.mu.Unlock()
 
+	if err := s.closeListeners(); err != nil {
+		return err
+	}
+
+	s.closeSessions()
+	s.stopWorkers()
+	s.logger.Debug("application stopped")
+	return nil
+}
+
+func (s *server[IN, OUT]) Shutdown(ctx context.Context) (ShutdownStats, error) {
+	var stats ShutdownStats
+	s.mu.Lock()
+	if !s.mu.running || s.mu.stopping {
+		s.mu.Unlock()
+		return stats, nil
+	}
+	// keep running to let the handlers remove and close their sessions
+	s.mu.stopping = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.mu.stopping = false
+		s.mu.Unlock()
+	}()
+
+	if err := s.closeListeners(); err != nil {
+		return stats, err
+	}
+
+	// now no new connection will added, notify all active sessions without the lock of the
+	// session map, so the sessions can be removed while notifying
+	var sessions []IOSession[IN, OUT]
+	for _, m := range s.sessions {
+		m.RLock()
+		for _, rs := range m.sessions {
+			sessions = append(sessions, rs)
+		}
+		m.RUnlock()
+	}
+	total := len(sessions)
+	if s.options.shutdownHook != nil {
+	OUTER:
+		for _, rs := range sessions {
+			select {
+			case <-ctx.Done():
+				s.logger.Warn("shutdown timeout while notifying sessions")
+				break OUTER
+			default:
+			}
+			if err := s.options.shutdownHook(rs); err != nil {
+				s.logger.Error("session shutdown hook failed",
+					zap.Uint64("session-id", rs.ID()),
+					zap.Error(err))
+			}
+		}
+	}
+
+	drainedC := make(chan struct{})
+	go func() {
+		s.handlers.Wait()
+		close(drainedC)
+	}()
+	select {
+	case <-drainedC:
+	case <-ctx.Done():
+	}
+
+	s.mu.Lock()
+	s.mu.running = false
+	s.mu.Unlock()
+
+	stats.Forced = s.closeSessions()
+	s.stopWorkers()
+	stats.Drained = total - stats.Forced
+	s.logger.Info("application shutdown",
+		zap.Int("drained", stats.Drained),
+		zap.Int("forced", stats.Forced))
+	return stats, nil
+}
+
+// closeListeners closes all listeners, and waits for the accept loops stopped
+func (s *server[IN, OUT]) closeListeners() error {
 	var errors []error
 	for _, listener := range s.listeners {
 		if err := listener.Close(); err != nil {
@@ -255,11 +556,32 @@ func (s *server[IN, OUT]) Stop() error {
 
 	s.logger.Debug("application listener closed")
 	s.wg.Wait()
+	if s.idle != nil {
+		s.idle.stop()
+	}
+	return nil
+}
 
-	// now no new connection will added, close all active sessions
+// stopWorkers stops the worker pool and the event loops after the read goroutines of the
+// sessions stopped, the queued messages of the disconnected sessions are skipped, so it only
+// waits for the handling messages.
+func (s *server[IN, OUT]) stopWorkers() {
+	if s.workers != nil {
+		s.handlers.Wait()
+		s.workers.stop()
+	}
+	if s.loops != nil {
+		s.loops.stop()
+	}
+}
+
+// closeSessions disconnects all active sessions, returns the number of the sessions
+func (s *server[IN, OUT]) closeSessions() int {
+	n := 0
 	for _, m := range s.sessions {
 		m.Lock()
 		for k, rs := range m.sessions {
+			n++
 			delete(m.sessions, k)
 			if err := rs.Disconnect(); err != nil {
 				s.logger.Error("session closed failed",
@@ -268,8 +590,11 @@ func (s *server[IN, OUT]) Stop() error {
 		}
 		m.Unlock()
 	}
-	s.logger.Debug("application stopped")
-	return nil
+	return n
+}
+
+func (s *server[IN, OUT]) RejectedConnections() uint64 {
+	return atomic.LoadUint64(&s.atomic.rejected)
 }
 
 func (s *server[IN, OUT]) GetSession(id uint64) (IOSession[IN, OUT], error) {
@@ -284,6 +609,76 @@ func (s *server[IN, OUT]) GetSession(id uint64) (IOSession[IN, OUT], error) {
 	return session, nil
 }
 
+func (s *server[IN, OUT]) Range(fn func(IOSession[IN, OUT]) bool) {
+	var sessions []IOSession[IN, OUT]
+	for i := uint64(0); i < s.options.sessionBucketSize; i++ {
+		// copy the sessions to call fn without holding the lock
+		m := s.sessions[i]
+		m.RLock()
+		for _, rs := range m.sessions {
+			sessions = append(sessions, rs)
+		}
+		m.RUnlock()
+
+		for _, rs := range sessions {
+			if !fn(rs) {
+				return
+			}
+		}
+		sessions = sessions[:0]
+	}
+}
+
+func (s *server[IN, OUT]) Count() int {
+	n := 0
+	for _, m := range s.sessions {
+		m.RLock()
+		n += len(m.sessions)
+		m.RUnlock()
+	}
+	return n
+}
+
+func (s *server[IN, OUT]) Broadcast(msg OUT, filter func(IOSession[IN, OUT]) bool) map[uint64]error {
+	return broadcast(s.Range, msg, filter, s.options.broadcastConcurrency, s.options.broadcastTimeout)
+}
+
+// broadcast writes and flushes the msg to the sessions iterated by rangeFunc and matched by
+// the filter, with at most concurrency sessions written at the same time.
+func broadcast[IN any, OUT any](
+	rangeFunc func(func(IOSession[IN, OUT]) bool),
+	msg OUT,
+	filter func(IOSession[IN, OUT]) bool,
+	concurrency int,
+	timeout time.Duration) map[uint64]error {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	errors := make(map[uint64]error)
+	limitC := make(chan struct{}, concurrency)
+	rangeFunc(func(rs IOSession[IN, OUT]) bool {
+		if filter != nil && !filter(rs) {
+			return true
+		}
+
+		limitC <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-limitC
+				wg.Done()
+			}()
+			if err := rs.Write(msg, WriteOptions{Timeout: timeout, Flush: true}); err != nil {
+				mu.Lock()
+				errors[rs.ID()] = err
+				mu.Unlock()
+			}
+		}()
+		return true
+	})
+	wg.Wait()
+	return errors
+}
+
 func (s *server[IN, OUT]) adjust() {
 	s.logger = adjustLogger(s.logger)
 	s.options.sessionOpts = append(s.options.sessionOpts,
@@ -291,6 +686,9 @@ func (s *server[IN, OUT]) adjust() {
 	if s.options.sessionBucketSize == 0 {
 		s.options.sessionBucketSize = defaultSessionBucketSize
 	}
+	if s.options.broadcastConcurrency <= 0 {
+		s.options.broadcastConcurrency = defaultBroadcastConcurrency
+	}
 }
 
 func (s *server[IN, OUT]) doStart() {
@@ -326,36 +724,9 @@ func (s *server[IN, OUT]) doStart() {
 			}
 			tempDelay = 0
 
-			var options []Option[IN, OUT]
-			options = append(options,
-				WithSessionConn[IN, OUT](s.nextID(), conn),
-				WithSessionLogger[IN, OUT](s.logger),
-				WithSessionAware(s.options.aware))
-			options = append(options, s.options.sessionOpts...)
-			rs := NewIOSession(options...)
-			if !s.addSession(rs) {
-				if err := rs.Close(); err != nil {
-					s.logger.Error("close session failed", zap.Error(err))
-				}
+			if !s.doAccept(conn) {
 				return
 			}
-
-			handle := s.options.handleSessionFunc
-			if handle == nil {
-				handle = s.doConnection
-			}
-			go func() {
-				defer func() {
-					if s.deleteSession(rs) {
-						if err := rs.Close(); err != nil {
-							s.logger.Error("close session failed", zap.Error(err))
-						}
-					}
-				}()
-				if err := handle(rs); err != nil {
-					s.logger.Error("handle session failed", zap.Error(err))
-				}
-			}()
 		}
 	}
 
@@ -365,20 +736,148 @@ func (s *server[IN, OUT]) doStart() {
 	}
 }
 
+// doAccept creates a session for the accepted conn if admitted, returns false if the
+// application is stopped.
+func (s *server[IN, OUT]) doAccept(conn net.Conn) bool {
+	if !s.admit(conn) {
+		return true
+	}
+
+	var options []Option[IN, OUT]
+	options = append(options,
+		WithSessionConn[IN, OUT](s.nextID(), conn),
+		WithSessionLogger[IN, OUT](s.logger),
+		WithSessionAware(s.options.aware))
+	options = append(options, s.options.sessionOpts...)
+	var lc *loopConn[IN, OUT]
+	if s.loops != nil {
+		if v, ok := newLoopConn(s, conn); ok {
+			lc = v
+			// the data is read into the buffer of the event loop, so the buffers of the
+			// session are only allocated to hold the incomplete messages and the unflushed data
+			options = append(options,
+				WithSessionLazyBuffers[IN, OUT](0),
+				withSessionCloseConnHook[IN, OUT](func() { lc.finish(true) }))
+		}
+	}
+	rs := NewIOSession(options...)
+	var inbound []InboundInterceptor[IN, OUT]
+	var outbound []OutboundInterceptor[IN, OUT]
+	if s.options.sessionInterceptors != nil {
+		inbound, outbound = s.options.sessionInterceptors(rs)
+	}
+	rs.(*baseIO[IN, OUT]).addInterceptors(inbound, append(outbound, s.options.outboundInterceptors...))
+	if !s.addSession(rs) {
+		if err := rs.Close(); err != nil {
+			s.logger.Error("close session failed", zap.Error(err))
+		}
+		if s.limiter != nil {
+			s.limiter.release(conn)
+		}
+		return false
+	}
+
+	s.handlers.Add(1)
+	if lc != nil {
+		lc.init(rs.(*baseIO[IN, OUT]))
+		s.loops.register(lc)
+		return true
+	}
+
+	handle := s.options.handleSessionFunc
+	if handle == nil {
+		handle = s.doConnection
+	}
+	go func() {
+		defer s.handlers.Done()
+		defer func() {
+			if r := recover(); r != nil {
+				s.onPanic(rs, s.logger, "session handle panic", r)
+			}
+			s.closeSession(rs, conn)
+		}()
+		if err := handle(rs); err != nil {
+			s.logger.Error("handle session failed", zap.Error(err))
+		}
+	}()
+	return true
+}
+
+// closeSession removes and closes the session after it handled
+func (s *server[IN, OUT]) closeSession(rs IOSession[IN, OUT], conn net.Conn) {
+	s.deleteSession(rs)
+	// the session disconnected by Stop also need to be closed to notify the
+	// IOSessionAware
+	if err := rs.Close(); err != nil {
+		s.logger.Error("close session failed", zap.Error(err))
+	}
+	if s.limiter != nil {
+		s.limiter.release(conn)
+	}
+}
+
+// admit checks the IPFilter, the connection limits and the AdmissionController, the
+// rejected conn is closed.
+func (s *server[IN, OUT]) admit(conn net.Conn) bool {
+	if s.options.ipFilter != nil && !s.options.ipFilter.allowConn(conn) {
+		atomic.AddUint64(&s.atomic.rejected, 1)
+		rejectConn(s.logger, conn, "ip not allowed", nil)
+		return false
+	}
+
+	if s.limiter != nil && !s.limiter.acquire(conn) {
+		atomic.AddUint64(&s.atomic.rejected, 1)
+		rejectConn(s.logger, conn, "too many connections", nil)
+		return false
+	}
+
+	if s.options.admission != nil {
+		if ok, message := s.options.admission.Admit(conn); !ok {
+			if s.limiter != nil {
+				s.limiter.release(conn)
+			}
+			atomic.AddUint64(&s.atomic.rejected, 1)
+			rejectConn(s.logger, conn, "rejected by admission controller", message)
+			return false
+		}
+	}
+	return true
+}
+
 func (s *server[IN, OUT]) doConnection(rs IOSession[IN, OUT]) error {
 	logger := s.logger.With(zap.Uint64("session-id", rs.ID()),
 		zap.String("addr", rs.RemoteAddress()))
 
 	logger.Debug("session connected")
 
+	handler := s.inboundHandler(rs)
 	received := uint64(0)
+	policy := s.options.errorPolicy
+
+	var ws *workerSession[IN, OUT]
+	if s.workers != nil {
+		ws = &workerSession[IN, OUT]{rs: rs, handler: handler, logger: logger}
+	}
 	for {
-		msg, err := rs.Read(ReadOptions{})
+		msg, err := s.readMessage(rs, logger)
 		if err != nil {
+			if ws != nil {
+				ws.close(err != io.EOF)
+			}
 			if err == io.EOF {
 				return nil
 			}
 
+			var ce *CodecError
+			if errors.As(err, &ce) {
+				logger.Error("session decode failed, close this session",
+					zap.Error(err))
+				if policy.OnCodecError != nil {
+					policy.OnCodecError(rs, ce)
+				}
+				return err
+			}
+
 			logger.Info("session read failed",
 				zap.Error(err))
 			return err
@@ -389,15 +888,61 @@ func (s *server[IN, OUT]) doConnection(rs IOSession[IN, OUT]) error {
 			ce.Write(zap.Uint64("sequence", received))
 		}
 
-		err = s.handleFunc(rs, msg, received)
-		if err != nil {
-			logger.Error("session handle failed, close this session",
-				zap.Error(err))
+		if ws != nil {
+			if err = s.workers.dispatch(ws, msg, received); err != nil {
+				logger.Error("dispatch message failed, close this session",
+					zap.Error(err))
+				ws.close(true)
+				return err
+			}
+			continue
+		}
+
+		err = s.handleMessage(handler, rs, msg, received, logger)
+		if err = s.checkHandleError(rs, msg, err, logger); err != nil {
 			return err
 		}
 	}
 }
 
+// checkHandleError returns nil if the session can continue to handle the next message after
+// the error returned by handleMessage.
+func (s *server[IN, OUT]) checkHandleError(rs IOSession[IN, OUT], msg IN, err error, logger *zap.Logger) error {
+	if err == nil {
+		return nil
+	}
+
+	policy := s.options.errorPolicy
+	var pe *PanicError
+	if errors.As(err, &pe) {
+		if policy.ContinueOnPanic {
+			return nil
+		}
+		return err
+	}
+
+	if policy.OnHandlerError != nil {
+		if err = policy.OnHandlerError(rs, msg, err); err == nil {
+			return nil
+		}
+	}
+	logger.Error("session handle failed, close this session",
+		zap.Error(err))
+	return err
+}
+
+// inboundHandler returns the handleFunc wrapped by the application and session level inbound
+// interceptors
+func (s *server[IN, OUT]) inboundHandler(rs IOSession[IN, OUT]) InboundHandler[IN, OUT] {
+	interceptors := s.options.inboundInterceptors
+	if holder, ok := rs.(inboundInterceptorsHolder[IN, OUT]); ok {
+		if values := holder.inboundInterceptors(); len(values) > 0 {
+			interceptors = append(interceptors[:len(interceptors):len(interceptors)], values...)
+		}
+	}
+	return ChainInboundInterceptors(s.handleFunc, interceptors...)
+}
+
 func (s *server[IN, OUT]) addSession(session IOSession[IN, OUT]) bool {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -1,7 +1,9 @@
 package goetty
 
 import (
+	"context"
 	"os"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -80,6 +82,224 @@ func TestStop(t *testing.T) {
 	}
 }
 
+func TestShutdown(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	for name, address := range testAddresses {
+		addr := address
+		t.Run(name, func(t *testing.T) {
+			app := newTestApp(t,
+				testListenAddresses,
+				func(i IOSession[string, string], a string, u uint64) error {
+					return i.Write(a, WriteOptions{Flush: true})
+				},
+				WithAppShutdownHook(func(rs IOSession[string, string]) error {
+					return rs.Write("goaway", WriteOptions{Flush: true})
+				}))
+			assert.NoError(t, app.Start())
+
+			// the first session closed on goaway, the second ignores it
+			wg := &sync.WaitGroup{}
+			for i := 0; i < 2; i++ {
+				session := newTestIOSession(t)
+				assert.NoError(t, session.Connect(addr, time.Second))
+				assert.NoError(t, session.Write("hello", WriteOptions{Flush: true}))
+				reply, err := session.Read(ReadOptions{})
+				assert.NoError(t, err)
+				assert.Equal(t, "hello", reply)
+
+				wg.Add(1)
+				go func(conn IOSession[string, string], closeOnGoaway bool) {
+					defer wg.Done()
+					defer conn.Close()
+					for {
+						msg, err := conn.Read(ReadOptions{})
+						if err != nil || (closeOnGoaway && msg == "goaway") {
+							return
+						}
+					}
+				}(session, i == 0)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*200)
+			defer cancel()
+			stats, err := app.Shutdown(ctx)
+			assert.NoError(t, err)
+			assert.Equal(t, ShutdownStats{Drained: 1, Forced: 1}, stats)
+			wg.Wait()
+			assert.NoError(t, app.Stop())
+		})
+	}
+}
+
+func TestShutdownWaitsInflightHandlers(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	startedC := make(chan struct{})
+	app := newTestApp(t,
+		testListenAddresses,
+		func(i IOSession[string, string], a string, u uint64) error {
+			close(startedC)
+			time.Sleep(time.Millisecond * 50)
+			return i.Write(a, WriteOptions{Flush: true})
+		})
+	assert.NoError(t, app.Start())
+
+	session := newTestIOSession(t)
+	assert.NoError(t, session.Connect(testUnixSocket, time.Second))
+	assert.NoError(t, session.Write("slow", WriteOptions{Flush: true}))
+	<-startedC
+
+	replyC := make(chan string, 1)
+	go func() {
+		defer session.Close()
+		reply, err := session.Read(ReadOptions{})
+		assert.NoError(t, err)
+		replyC <- reply
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	stats, err := app.Shutdown(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, ShutdownStats{Drained: 1}, stats)
+	assert.Equal(t, "slow", <-replyC)
+}
+
+func TestShutdownWithSlowHook(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	hookC := make(chan struct{}, 2)
+	releaseC := make(chan struct{})
+	app := newTestApp(t,
+		[]string{testUnixSocket},
+		func(i IOSession[string, string], a string, u uint64) error {
+			return i.Write(a, WriteOptions{Flush: true})
+		},
+		WithAppSessionBucketSize[string, string](1),
+		WithAppShutdownHook(func(rs IOSession[string, string]) error {
+			hookC <- struct{}{}
+			<-releaseC
+			return nil
+		}))
+	assert.NoError(t, app.Start())
+
+	var sessions []IOSession[string, string]
+	for i := 0; i < 2; i++ {
+		session := newTestIOSession(t)
+		assert.NoError(t, session.Connect(testUnixSocket, time.Second))
+		assertTestEcho(t, session)
+		sessions = append(sessions, session)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	statsC := make(chan ShutdownStats, 1)
+	go func() {
+		stats, err := app.Shutdown(ctx)
+		assert.NoError(t, err)
+		statsC <- stats
+	}()
+
+	// the sessions can be removed while the hook is blocked
+	<-hookC
+	assert.NoError(t, sessions[0].Close())
+	assert.NoError(t, sessions[1].Close())
+	assert.Eventually(t, func() bool {
+		return app.Count() == 0
+	}, time.Second, time.Millisecond*10)
+
+	// the next hook is skipped after the ctx done
+	<-ctx.Done()
+	close(releaseC)
+	assert.Equal(t, ShutdownStats{Drained: 2}, <-statsC)
+	assert.Equal(t, 0, len(hookC))
+	assert.NoError(t, app.Stop())
+}
+
+func TestRangeAndCount(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	app := newTestApp(t,
+		testListenAddresses,
+		func(i IOSession[string, string], a string, u uint64) error {
+			return i.Write(a, WriteOptions{Flush: true})
+		})
+	assert.NoError(t, app.Start())
+	defer app.Stop()
+
+	n := 5
+	for i := 0; i < n; i++ {
+		session := newTestIOSession(t)
+		defer session.Close()
+		assert.NoError(t, session.Connect(testUnixSocket, time.Second))
+		assertTestEcho(t, session)
+	}
+	assert.Equal(t, n, app.Count())
+
+	ids := make(map[uint64]struct{})
+	app.Range(func(rs IOSession[string, string]) bool {
+		ids[rs.ID()] = struct{}{}
+		return true
+	})
+	assert.Equal(t, n, len(ids))
+
+	c := 0
+	app.Range(func(rs IOSession[string, string]) bool {
+		c++
+		return c < 2
+	})
+	assert.Equal(t, 2, c)
+}
+
+func TestBroadcast(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	app := newTestApp(t,
+		testListenAddresses,
+		func(i IOSession[string, string], a string, u uint64) error {
+			return i.Write(a, WriteOptions{Flush: true})
+		},
+		WithAppBroadcast[string, string](2, time.Second))
+	assert.NoError(t, app.Start())
+	defer app.Stop()
+
+	n := 6
+	var sessions []IOSession[string, string]
+	for i := 0; i < n; i++ {
+		session := newTestIOSession(t)
+		defer session.Close()
+		assert.NoError(t, session.Connect(testUnixSocket, time.Second))
+		assertTestEcho(t, session)
+		sessions = append(sessions, session)
+	}
+
+	var failed, skipped uint64
+	errors := app.Broadcast("push", func(rs IOSession[string, string]) bool {
+		switch {
+		case failed == 0:
+			failed = rs.ID()
+			assert.NoError(t, rs.Disconnect())
+		case skipped == 0:
+			skipped = rs.ID()
+			return false
+		}
+		return true
+	})
+	assert.Equal(t, 1, len(errors))
+	assert.Error(t, errors[failed])
+
+	received := 0
+	for _, session := range sessions {
+		msg, err := session.Read(ReadOptions{Timeout: time.Millisecond * 100})
+		if err == nil {
+			assert.Equal(t, "push", msg)
+			received++
+		}
+	}
+	assert.Equal(t, n-2, received)
+}
+
 func TestStartWithTLS(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 
@@ -125,8 +345,15 @@ func newTestAppWithCodec[IN string, OUT string](t assert.TestingT,
 			return nil
 		}
 	}
-	assert.NoError(t, os.RemoveAll(testUnixSocket[7:]))
-	opts = append(opts, WithAppSessionOptions(WithSessionCodec(codec)))
+	for _, address := range addresses {
+		if strings.HasPrefix(address, "unix://") {
+			assert.NoError(t, os.RemoveAll(address[7:]))
+		}
+	}
+	// keep the session options set by the opts
+	opts = append(opts, func(s *server[string, string]) {
+		s.options.sessionOpts = append(s.options.sessionOpts, WithSessionCodec(codec))
+	})
 	app, err := NewApplicationWithListenAddress(addresses, handleFunc, opts...)
 	assert.NoError(t, err)
 	return app
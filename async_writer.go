@@ -0,0 +1,244 @@
+package goetty
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrWriteQueueClosed the async write queue is closed, the message was not written
+	ErrWriteQueueClosed = errors.New("async write queue closed")
+	// ErrWriteQueueFull the async write queue is full and no space was freed before timeout
+	ErrWriteQueueFull = errors.New("async write queue is full")
+)
+
+type asyncWriteRequest[OUT any] struct {
+	msg      OUT
+	callback func(error)
+	err      error
+	// barrier the request has no message, it is used to wait for the previous requests
+	barrier bool
+}
+
+// asyncWriter holds a bounded queue of messages which is drained by a dedicated goroutine.
+// The goroutine encodes the queued messages into the out buffer of the IOSession in batches
+// and flushes each batch to the net.Conn. The goroutine is started when the connection is
+// established and stopped before the connection is closed, all messages still in the queue
+// are flushed or failed during stop.
+type asyncWriter[IN any, OUT any] struct {
+	bio   *baseIO[IN, OUT]
+	queue chan asyncWriteRequest[OUT]
+	batch []asyncWriteRequest[OUT]
+	// writers number of goroutines which are trying to put requests into queue
+	writers sync.WaitGroup
+	// stopping true if the drain deadline is set by stop, protected by the writeMu of the
+	// IOSession
+	stopping bool
+
+	mu struct {
+		sync.RWMutex
+		running bool
+		stopC   chan struct{}
+		drainC  chan struct{}
+		doneC   chan struct{}
+	}
+}
+
+func newAsyncWriter[IN any, OUT any](bio *baseIO[IN, OUT], queueSize int) *asyncWriter[IN, OUT] {
+	return &asyncWriter[IN, OUT]{
+		bio:   bio,
+		queue: make(chan asyncWriteRequest[OUT], queueSize),
+		batch: make([]asyncWriteRequest[OUT], 0, queueSize),
+	}
+}
+
+func (w *asyncWriter[IN, OUT]) start() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.mu.running {
+		return
+	}
+
+	w.bio.writeMu.Lock()
+	w.stopping = false
+	w.bio.writeMu.Unlock()
+
+	w.mu.running = true
+	w.mu.stopC = make(chan struct{})
+	w.mu.drainC = make(chan struct{})
+	w.mu.doneC = make(chan struct{})
+	go w.run(w.mu.drainC, w.mu.doneC)
+}
+
+// stop stops accepting new messages, and waits for the write goroutine to flush all the
+// queued messages. The flush of the queued messages must be completed in drainTimeout.
+func (w *asyncWriter[IN, OUT]) stop(drainTimeout time.Duration) {
+	w.mu.Lock()
+	if !w.mu.running {
+		w.mu.Unlock()
+		return
+	}
+	w.mu.running = false
+	close(w.mu.stopC)
+	drainC, doneC := w.mu.drainC, w.mu.doneC
+	w.mu.Unlock()
+
+	// all blocked writers will return ErrWriteQueueClosed once stopC closed
+	w.writers.Wait()
+	// a flush may be blocked by the peer, make sure it will be completed in drainTimeout
+	deadline := time.Now().Add(drainTimeout)
+	w.bio.conn.SetWriteDeadline(deadline)
+	// the flush in progress may reset the deadline, the later flushes keep the deadline
+	w.bio.writeMu.Lock()
+	w.stopping = true
+	w.bio.conn.SetWriteDeadline(deadline)
+	w.bio.writeMu.Unlock()
+	close(drainC)
+	<-doneC
+}
+
+// flush waits until all the messages queued before are flushed to the net.Conn, returns
+// the error of the flush.
+func (w *asyncWriter[IN, OUT]) flush(timeout time.Duration) error {
+	var flushErr error
+	doneC := make(chan struct{})
+	err := w.put(asyncWriteRequest[OUT]{
+		barrier: true,
+		callback: func(err error) {
+			flushErr = err
+			close(doneC)
+		},
+	}, timeout)
+	if err != nil {
+		return err
+	}
+	<-doneC
+	return flushErr
+}
+
+func (w *asyncWriter[IN, OUT]) enqueue(msg OUT, options WriteOptions) error {
+	return w.put(asyncWriteRequest[OUT]{msg: msg, callback: options.Callback}, options.Timeout)
+}
+
+func (w *asyncWriter[IN, OUT]) put(req asyncWriteRequest[OUT], timeout time.Duration) error {
+	w.mu.RLock()
+	if !w.mu.running {
+		w.mu.RUnlock()
+		return ErrWriteQueueClosed
+	}
+	stopC := w.mu.stopC
+	w.writers.Add(1)
+	w.mu.RUnlock()
+	defer w.writers.Done()
+
+	select {
+	case w.queue <- req:
+		return nil
+	default:
+	}
+
+	var timeoutC <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timeoutC = timer.C
+	}
+
+	select {
+	case w.queue <- req:
+		return nil
+	case <-stopC:
+		return ErrWriteQueueClosed
+	case <-timeoutC:
+		return ErrWriteQueueFull
+	}
+}
+
+func (w *asyncWriter[IN, OUT]) run(drainC, doneC chan struct{}) {
+	defer close(doneC)
+
+	for {
+		select {
+		case req := <-w.queue:
+			w.writeBatch(req, 0)
+		case <-drainC:
+			for {
+				select {
+				case req := <-w.queue:
+					// deadline is already set by stop
+					w.writeBatch(req, -1)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// writeBatch encodes the req and all the requests currently in the queue into the out
+// buffer, and flush them with one write.
+func (w *asyncWriter[IN, OUT]) writeBatch(req asyncWriteRequest[OUT], timeout time.Duration) {
+	w.batch = append(w.batch[:0], req)
+OUTER:
+	for len(w.batch) < cap(w.batch) {
+		select {
+		case req := <-w.queue:
+			w.batch = append(w.batch, req)
+		default:
+			break OUTER
+		}
+	}
+
+	err := w.flushBatch(timeout)
+	for idx := range w.batch {
+		if w.batch[idx].callback != nil {
+			if w.batch[idx].err != nil {
+				w.batch[idx].callback(w.batch[idx].err)
+			} else {
+				w.batch[idx].callback(err)
+			}
+		}
+		w.batch[idx] = asyncWriteRequest[OUT]{}
+	}
+	if err != nil {
+		w.bio.logger.Error("async write failed",
+			zap.Int("messages", len(w.batch)),
+			zap.Error(err))
+	}
+}
+
+// flushBatch encodes the batch into the out buffer, and flushes the out buffer
+func (w *asyncWriter[IN, OUT]) flushBatch(timeout time.Duration) error {
+	bio := w.bio
+	bio.writeMu.Lock()
+	defer bio.writeMu.Unlock()
+
+	// the drain deadline is set by stop
+	if w.stopping {
+		timeout = -1
+	}
+	for idx := range w.batch {
+		if !w.batch[idx].barrier {
+			w.batch[idx].err = w.encode(w.batch[idx].msg)
+		}
+	}
+	if bio.pendingFlush() {
+		return bio.doFlush(timeout)
+	}
+	return nil
+}
+
+// encode encodes the msg into the out buffer, the panic of the codec fails the msg instead
+// of the write goroutine.
+func (w *asyncWriter[IN, OUT]) encode(msg OUT) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r}
+		}
+	}()
+	return w.bio.encode(msg)
+}
@@ -0,0 +1,142 @@
+package goetty
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fagongzi/goetty/v3/codec/simple"
+	"github.com/lni/goutils/leaktest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAsyncWrite(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	for name, address := range testAddresses {
+		addr := address
+		t.Run(name, func(t *testing.T) {
+			app := newTestApp(t,
+				testListenAddresses,
+				func(rs IOSession[string, string], msg string, received uint64) error {
+					return rs.Write(msg, WriteOptions{})
+				},
+				WithAppSessionOptions(WithSessionAsyncWrite[string, string](16)))
+			assert.NoError(t, app.Start())
+			defer app.Stop()
+
+			client := newTestIOSession(t, WithSessionAsyncWrite[string, string](16))
+			defer client.Close()
+			assert.NoError(t, client.Connect(addr, time.Second))
+
+			n := 10
+			messages := 100
+			var completed uint64
+			var wg sync.WaitGroup
+			for i := 0; i < n; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					for j := 0; j < messages; j++ {
+						assert.NoError(t, client.Write(fmt.Sprintf("%d-%d", i, j), WriteOptions{
+							Callback: func(err error) {
+								assert.NoError(t, err)
+								atomic.AddUint64(&completed, 1)
+							},
+						}))
+					}
+				}(i)
+			}
+
+			received := make(map[string]struct{}, n*messages)
+			for i := 0; i < n*messages; i++ {
+				msg, err := client.Read(ReadOptions{Timeout: time.Second * 5})
+				assert.NoError(t, err)
+				received[msg] = struct{}{}
+			}
+			wg.Wait()
+			assert.Equal(t, n*messages, len(received))
+			assert.Equal(t, uint64(n*messages), atomic.LoadUint64(&completed))
+		})
+	}
+}
+
+func TestAsyncWriteFlushQueuedOnClose(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	received := make(chan string, 100)
+	app := newTestApp(t,
+		[]string{testUnixSocket},
+		func(rs IOSession[string, string], msg string, _ uint64) error {
+			received <- msg
+			return nil
+		})
+	assert.NoError(t, app.Start())
+	defer app.Stop()
+
+	for _, disconnect := range []bool{false, true} {
+		client := newTestIOSession(t, WithSessionAsyncWrite[string, string](100))
+		assert.NoError(t, client.Connect(testUnixSocket, time.Second))
+
+		var completed uint64
+		for i := 0; i < 100; i++ {
+			assert.NoError(t, client.Write(fmt.Sprintf("%d", i), WriteOptions{
+				Callback: func(err error) {
+					assert.NoError(t, err)
+					atomic.AddUint64(&completed, 1)
+				},
+			}))
+		}
+		if disconnect {
+			assert.NoError(t, client.Disconnect())
+		} else {
+			assert.NoError(t, client.Close())
+		}
+		assert.Equal(t, uint64(100), atomic.LoadUint64(&completed))
+		assert.Equal(t, ErrIllegalState, client.Write("closed", WriteOptions{}))
+		if disconnect {
+			assert.NoError(t, client.Close())
+		}
+
+		for i := 0; i < 100; i++ {
+			select {
+			case msg := <-received:
+				assert.Equal(t, fmt.Sprintf("%d", i), msg)
+			case <-time.After(time.Second * 5):
+				assert.FailNow(t, "timeout")
+			}
+		}
+	}
+}
+
+func TestAsyncWriteEncodePanic(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	app := newTestApp(t, []string{testUnixSocket},
+		func(rs IOSession[string, string], msg string, received uint64) error {
+			return rs.Write(msg, WriteOptions{Flush: true})
+		})
+	assert.NoError(t, app.Start())
+	defer app.Stop()
+
+	client := newTestIOSession(t,
+		WithSessionCodec[string, string](&testErrorCodec{Codec: simple.NewStringCodec()}),
+		WithSessionAsyncWrite[string, string](16))
+	defer client.Close()
+	assert.NoError(t, client.Connect(testUnixSocket, time.Second))
+
+	errC := make(chan error, 1)
+	assert.NoError(t, client.Write("encode-panic", WriteOptions{
+		Callback: func(err error) {
+			errC <- err
+		},
+	}))
+	var pe *PanicError
+	assert.ErrorAs(t, <-errC, &pe)
+	assert.Equal(t, "encode panic", pe.Value)
+
+	// the write goroutine keeps working
+	assertTestEcho(t, client)
+}
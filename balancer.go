@@ -0,0 +1,219 @@
+package goetty
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// UpstreamInfo the info of a proxy upstream to be selected by the Balancer
+type UpstreamInfo struct {
+	// Address address of the upstream
+	Address string
+	// Weight weight of the upstream, at least 1
+	Weight int
+	// ActiveConns number of the active proxied connections to the upstream
+	ActiveConns int
+}
+
+// Balancer selects an upstream for the client connection of the proxy. Select is called with
+// the lock of the proxy held, so the Balancer is not called concurrently, and must not call
+// the Proxy.
+type Balancer interface {
+	// Select returns the index of the selected upstream, the upstreams are the healthy ones
+	// and never empty.
+	Select(client net.Addr, upstreams []UpstreamInfo) int
+}
+
+// NewRoundRobinBalancer returns a smooth weighted round robin Balancer, the upstreams are
+// selected in turn if they have the same weight. It is the default Balancer of the proxy.
+func NewRoundRobinBalancer() Balancer {
+	return &roundRobinBalancer{current: make(map[string]int)}
+}
+
+type roundRobinBalancer struct {
+	// current the current weights of the upstreams
+	current map[string]int
+}
+
+func (b *roundRobinBalancer) Select(client net.Addr, upstreams []UpstreamInfo) int {
+	if len(b.current) > len(upstreams) {
+		b.removeStale(upstreams)
+	}
+
+	total := 0
+	selected := 0
+	for idx, up := range upstreams {
+		total += up.Weight
+		b.current[up.Address] += up.Weight
+		if b.current[up.Address] > b.current[upstreams[selected].Address] {
+			selected = idx
+		}
+	}
+	b.current[upstreams[selected].Address] -= total
+	return selected
+}
+
+// removeStale removes the upstreams removed or unhealthy, so they are selected from the
+// beginning once they are back
+func (b *roundRobinBalancer) removeStale(upstreams []UpstreamInfo) {
+	for address := range b.current {
+		found := false
+		for _, up := range upstreams {
+			if up.Address == address {
+				found = true
+				break
+			}
+		}
+		if !found {
+			delete(b.current, address)
+		}
+	}
+}
+
+// NewLeastConnBalancer returns a Balancer which selects the upstream with the least active
+// connections per weight, the upstreams with the same load are selected in turn.
+func NewLeastConnBalancer() Balancer {
+	return &leastConnBalancer{}
+}
+
+type leastConnBalancer struct {
+	seq int
+}
+
+func (b *leastConnBalancer) Select(client net.Addr, upstreams []UpstreamInfo) int {
+	b.seq++
+	n := len(upstreams)
+	selected := b.seq % n
+	for i := 1; i < n; i++ {
+		idx := (b.seq + i) % n
+		if lessLoaded(upstreams[idx], upstreams[selected]) {
+			selected = idx
+		}
+	}
+	return selected
+}
+
+// NewP2CBalancer returns a power of two random choices Balancer, it selects the upstream with
+// less active connections per weight from two random upstreams.
+func NewP2CBalancer() Balancer {
+	return &p2cBalancer{rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+}
+
+type p2cBalancer struct {
+	rand *rand.Rand
+}
+
+func (b *p2cBalancer) Select(client net.Addr, upstreams []UpstreamInfo) int {
+	n := len(upstreams)
+	if n == 1 {
+		return 0
+	}
+
+	a := b.rand.Intn(n)
+	c := b.rand.Intn(n - 1)
+	if c >= a {
+		c++
+	}
+	if lessLoaded(upstreams[c], upstreams[a]) {
+		return c
+	}
+	return a
+}
+
+// lessLoaded returns true if a has less active connections per weight than b
+func lessLoaded(a, b UpstreamInfo) bool {
+	return a.ActiveConns*b.Weight < b.ActiveConns*a.Weight
+}
+
+// NewConsistentHashBalancer returns a Balancer which selects the upstream by the consistent
+// hash of the client ip, so the connections of a client are routed to the same upstream
+// until the upstreams changed. Each upstream has replicas*weight virtual nodes on the hash
+// ring, the replicas is 100 if it is not positive.
+func NewConsistentHashBalancer(replicas int) Balancer {
+	if replicas <= 0 {
+		replicas = defaultConsistentHashReplicas
+	}
+	return &consistentHashBalancer{replicas: replicas}
+}
+
+type consistentHashBalancer struct {
+	replicas int
+	// key the addresses and weights of the upstreams the ring built with
+	key   string
+	ring  []uint32
+	nodes map[uint32]string
+}
+
+func (b *consistentHashBalancer) Select(client net.Addr, upstreams []UpstreamInfo) int {
+	b.maybeRebuild(upstreams)
+
+	h := hashKey(clientKey(client))
+	idx := sort.Search(len(b.ring), func(i int) bool { return b.ring[i] >= h })
+	if idx == len(b.ring) {
+		idx = 0
+	}
+	address := b.nodes[b.ring[idx]]
+	for i, up := range upstreams {
+		if up.Address == address {
+			return i
+		}
+	}
+	return 0
+}
+
+func (b *consistentHashBalancer) maybeRebuild(upstreams []UpstreamInfo) {
+	var sb strings.Builder
+	for _, up := range upstreams {
+		sb.WriteString(up.Address)
+		sb.WriteByte('/')
+		sb.WriteString(strconv.Itoa(up.Weight))
+		sb.WriteByte(',')
+	}
+	key := sb.String()
+	if key == b.key {
+		return
+	}
+
+	b.key = key
+	b.ring = b.ring[:0]
+	b.nodes = make(map[uint32]string)
+	for _, up := range upstreams {
+		for i := 0; i < b.replicas*up.Weight; i++ {
+			h := hashKey(up.Address + "#" + strconv.Itoa(i))
+			if _, ok := b.nodes[h]; ok {
+				continue
+			}
+			b.nodes[h] = up.Address
+			b.ring = append(b.ring, h)
+		}
+	}
+	sort.Slice(b.ring, func(i, j int) bool { return b.ring[i] < b.ring[j] })
+}
+
+// clientKey returns the ip of the client address, the whole address if no ip
+func clientKey(client net.Addr) string {
+	if client == nil {
+		return ""
+	}
+	switch addr := client.(type) {
+	case *net.TCPAddr:
+		return addr.IP.String()
+	case *net.UDPAddr:
+		return addr.IP.String()
+	}
+	if host, _, err := net.SplitHostPort(client.String()); err == nil {
+		return host
+	}
+	return client.String()
+}
+
+func hashKey(key string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return h.Sum32()
+}
@@ -0,0 +1,130 @@
+package goetty
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/lni/goutils/leaktest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoundRobinBalancer(t *testing.T) {
+	b := NewRoundRobinBalancer()
+	upstreams := []UpstreamInfo{{Address: "a", Weight: 1}, {Address: "b", Weight: 1}}
+	for i := 0; i < 4; i++ {
+		assert.Equal(t, i%2, b.Select(nil, upstreams))
+	}
+
+	upstreams = []UpstreamInfo{{Address: "a", Weight: 3}, {Address: "b", Weight: 1}}
+	selected := map[int]int{}
+	for i := 0; i < 8; i++ {
+		selected[b.Select(nil, upstreams)]++
+	}
+	assert.Equal(t, map[int]int{0: 6, 1: 2}, selected)
+
+	// the removed upstream is selected from the beginning once it is back
+	assert.Equal(t, 0, b.Select(nil, upstreams[:1]))
+	assert.Equal(t, 1, len(b.(*roundRobinBalancer).current))
+}
+
+func TestLeastConnBalancer(t *testing.T) {
+	b := NewLeastConnBalancer()
+	upstreams := []UpstreamInfo{
+		{Address: "a", Weight: 1, ActiveConns: 2},
+		{Address: "b", Weight: 1, ActiveConns: 0},
+		{Address: "c", Weight: 1, ActiveConns: 1},
+	}
+	assert.Equal(t, 1, b.Select(nil, upstreams))
+
+	// the same load per weight are selected in turn
+	upstreams = []UpstreamInfo{
+		{Address: "a", Weight: 2, ActiveConns: 2},
+		{Address: "b", Weight: 1, ActiveConns: 1},
+	}
+	selected := map[int]int{}
+	for i := 0; i < 4; i++ {
+		selected[b.Select(nil, upstreams)]++
+	}
+	assert.Equal(t, map[int]int{0: 2, 1: 2}, selected)
+}
+
+func TestP2CBalancer(t *testing.T) {
+	b := NewP2CBalancer()
+	assert.Equal(t, 0, b.Select(nil, []UpstreamInfo{{Address: "a", Weight: 1}}))
+
+	upstreams := []UpstreamInfo{
+		{Address: "a", Weight: 1, ActiveConns: 0},
+		{Address: "b", Weight: 1, ActiveConns: 100},
+	}
+	for i := 0; i < 100; i++ {
+		assert.Equal(t, 0, b.Select(nil, upstreams))
+	}
+
+	upstreams = append(upstreams, UpstreamInfo{Address: "c", Weight: 1, ActiveConns: 100})
+	for i := 0; i < 100; i++ {
+		idx := b.Select(nil, upstreams)
+		assert.True(t, idx >= 0 && idx < len(upstreams))
+	}
+}
+
+func TestConsistentHashBalancer(t *testing.T) {
+	b := NewConsistentHashBalancer(0)
+	upstreams := []UpstreamInfo{
+		{Address: "a", Weight: 1},
+		{Address: "b", Weight: 1},
+		{Address: "c", Weight: 1},
+	}
+
+	// the connections of a client are sticky
+	client := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1000}
+	selected := upstreams[b.Select(client, upstreams)].Address
+	for port := 1001; port < 1010; port++ {
+		idx := b.Select(&net.TCPAddr{IP: client.IP, Port: port}, upstreams)
+		assert.Equal(t, selected, upstreams[idx].Address)
+	}
+	reversed := []UpstreamInfo{upstreams[2], upstreams[1], upstreams[0]}
+	assert.Equal(t, selected, reversed[b.Select(client, reversed)].Address)
+
+	// the clients are distributed to all upstreams
+	counts := map[string]int{}
+	for i := 0; i < 1000; i++ {
+		client := &net.TCPAddr{IP: net.ParseIP(fmt.Sprintf("10.0.%d.%d", i/256, i%256))}
+		counts[upstreams[b.Select(client, upstreams)].Address]++
+	}
+	for _, up := range upstreams {
+		assert.True(t, counts[up.Address] > 200, "%s: %d", up.Address, counts[up.Address])
+	}
+}
+
+func TestClientKey(t *testing.T) {
+	assert.Equal(t, "", clientKey(nil))
+	assert.Equal(t, "10.0.0.1", clientKey(&net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 80}))
+	assert.Equal(t, "/tmp/a.sock", clientKey(&net.UnixAddr{Name: "/tmp/a.sock", Net: "unix"}))
+}
+
+func TestProxyWithWeightedUpstreams(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	proxy := newTestProxy(t, nil, WithProxyBalancer(NewRoundRobinBalancer()))
+	defer func() {
+		assert.NoError(t, proxy.Stop())
+	}()
+	upstream1 := newTestUpstream(t, upstream1Address, "upstream1")
+	defer func() {
+		assert.NoError(t, upstream1.Stop())
+	}()
+	upstream2 := newTestUpstream(t, upstream2Address, "upstream2")
+	defer func() {
+		assert.NoError(t, upstream2.Stop())
+	}()
+	proxy.AddUpStream(upstream1Address, time.Second, WithUpstreamWeight(3))
+	proxy.AddUpStream(upstream2Address, time.Second)
+
+	replies := map[string]int{}
+	for i := 0; i < 8; i++ {
+		replies[mustProxyRequest(t)]++
+	}
+	assert.Equal(t, map[string]int{"upstream1": 6, "upstream2": 2}, replies)
+}
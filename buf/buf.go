@@ -99,7 +99,9 @@ func NewByteBuf(capacity int, opts ...Option) *ByteBuf {
 		opt(b)
 	}
 	b.adjust()
-	b.buf = b.options.allocator.Allocate(capacity)
+	if capacity > 0 {
+		b.buf = b.options.allocator.Allocate(capacity)
+	}
 	return b
 }
 
@@ -117,8 +119,32 @@ func (b *ByteBuf) adjust() {
 
 // Close close the ByteBuf
 func (b *ByteBuf) Close() {
+	if b.buf != nil {
+		b.options.allocator.Free(b.buf)
+	}
+	b.buf = nil
+}
+
+// Capacity returns the size of the internal []byte
+func (b *ByteBuf) Capacity() int {
+	return b.capacity()
+}
+
+// Shrink frees the internal []byte to the allocator, and allocates a new one with the
+// capacity, 0 capacity means allocate on next write. Nothing to do if the ByteBuf has
+// readable data or the capacity is not less than the current. Returns true if shrunk.
+func (b *ByteBuf) Shrink(capacity int) bool {
+	if b.Readable() > 0 || capacity >= b.capacity() {
+		return false
+	}
+
 	b.options.allocator.Free(b.buf)
 	b.buf = nil
+	if capacity > 0 {
+		b.buf = b.options.allocator.Allocate(capacity)
+	}
+	b.Reset()
+	return true
 }
 
 // Reset reset to reuse.
@@ -452,7 +478,9 @@ func (b *ByteBuf) Grow(n int) {
 			b.writerIndex = offset
 		}
 
-		b.options.allocator.Free(b.buf)
+		if b.buf != nil {
+			b.options.allocator.Free(b.buf)
+		}
 		b.buf = newBuf
 	}
 }
@@ -228,3 +228,23 @@ func TestGrowWithDisableResetReadAndWrite(t *testing.T) {
 	assert.Equal(t, 1, buf.readerIndex)
 	assert.Equal(t, 5+n, buf.GetWriteIndex())
 }
+
+func TestShrink(t *testing.T) {
+	buf := NewByteBuf(1024)
+	assert.Equal(t, 1024, buf.Capacity())
+	buf.MustWrite([]byte("hello"))
+	assert.False(t, buf.Shrink(0))
+
+	buf.Skip(5)
+	assert.False(t, buf.Shrink(1024))
+	assert.True(t, buf.Shrink(16))
+	assert.Equal(t, 16, buf.Capacity())
+	assert.True(t, buf.Shrink(0))
+	assert.Equal(t, 0, buf.Capacity())
+	assert.Equal(t, 0, buf.Readable())
+
+	buf.MustWrite([]byte("hello"))
+	_, data := buf.ReadAll()
+	assert.Equal(t, "hello", string(data))
+	assert.True(t, buf.Capacity() > 0)
+}
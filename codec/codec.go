@@ -13,3 +13,15 @@ type Codec[IN any, OUT any] interface {
 	// Decode decode message from the bytes buffer, returns false if there is not enough data.
 	Decode(in *buf.ByteBuf) (message IN, complete bool, err error)
 }
+
+// BuffersWriter is implemented by the conn passed to Codec.Encode if the vectored writes are
+// enabled. The codec can append the caller-owned bytes to the outbound buffers instead of
+// copying them into the out buffer, the bytes are written after the data encoded into the out
+// buffer before, and must not be modified until the message released.
+type BuffersWriter interface {
+	io.Writer
+	// AppendBuffer appends the bytes to the outbound buffers
+	AppendBuffer(data []byte)
+	// Appended returns the total size of the appended bytes not flushed
+	Appended() int
+}
@@ -79,14 +79,23 @@ func (c *lengthCodec[IN, OUT]) Encode(message OUT, out *buf.ByteBuf, conn io.Wri
 	oldIndexOffset := out.Readable()
 	out.Grow(4)
 	out.SetWriteIndex(out.GetReadIndex() + oldIndexOffset + 4)
+	// the bytes appended to the outbound buffers are part of the body
+	bw, vectored := conn.(codec.BuffersWriter)
+	appended := 0
+	if vectored {
+		appended = bw.Appended()
+	}
 	err := c.baseCodec.Encode(message, out, conn)
 	if err != nil {
 		return err
 	}
+	if vectored {
+		appended = bw.Appended() - appended
+	}
 	newIndex := out.GetWriteIndex()
 	oldIndex := out.GetReadIndex() + oldIndexOffset
 	out.SetWriteIndex(oldIndex)
-	out.WriteInt(newIndex - oldIndex - 4)
+	out.WriteInt(newIndex - oldIndex - 4 + appended)
 	out.SetWriteIndex(newIndex)
 	return nil
 }
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/fagongzi/goetty/v3/buf"
+	"github.com/fagongzi/goetty/v3/codec"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -33,6 +34,16 @@ func TestEncode(t *testing.T) {
 	assert.Equal(t, "world", string(v))
 }
 
+func TestEncodeWithBuffersWriter(t *testing.T) {
+	codec := New[[]byte, []byte](&appendCodec{})
+	buf := buf.NewByteBuf(32)
+	w := &buffersWriter{}
+	assert.NoError(t, codec.Encode([]byte("hello"), buf, w))
+	assert.Equal(t, 4, buf.Readable())
+	assert.Equal(t, 5, buf.ReadInt())
+	assert.Equal(t, 5, w.Appended())
+}
+
 func TestDecodeWithInvalidLength(t *testing.T) {
 	baseCodec := &bytesCodec{}
 	codec := New[[]byte, []byte](baseCodec)
@@ -58,3 +69,25 @@ func (c *bytesCodec) Encode(data []byte, out *buf.ByteBuf, conn io.Writer) error
 	out.Write(data)
 	return nil
 }
+
+type appendCodec struct {
+	bytesCodec
+}
+
+func (c *appendCodec) Encode(data []byte, out *buf.ByteBuf, conn io.Writer) error {
+	conn.(codec.BuffersWriter).AppendBuffer(data)
+	return nil
+}
+
+type buffersWriter struct {
+	io.Writer
+	appended int
+}
+
+func (w *buffersWriter) AppendBuffer(data []byte) {
+	w.appended += len(data)
+}
+
+func (w *buffersWriter) Appended() int {
+	return w.appended
+}
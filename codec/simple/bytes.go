@@ -9,7 +9,8 @@ import (
 )
 
 // NewBytesCodec returns a codec to used to encode and decode []byte. It used lengthCodec to add a length
-// field to head.
+// field to head. If the vectored writes enabled, the []byte is written without copy and must not be
+// modified until the message released.
 func NewBytesCodec() codec.Codec[[]byte, []byte] {
 	return length.New[[]byte, []byte](&bytesCodec{})
 }
@@ -22,6 +23,11 @@ func (c *bytesCodec) Decode(in *buf.ByteBuf) ([]byte, bool, error) {
 }
 
 func (c *bytesCodec) Encode(data []byte, out *buf.ByteBuf, conn io.Writer) error {
+	// the data is written without copy if the vectored writes enabled
+	if bw, ok := conn.(codec.BuffersWriter); ok {
+		bw.AppendBuffer(data)
+		return nil
+	}
 	out.Write(data)
 	return nil
 }
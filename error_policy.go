@@ -0,0 +1,99 @@
+package goetty
+
+import (
+	"fmt"
+
+	"go.uber.org/zap"
+)
+
+// CodecError is returned by IOSession.Read if the codec failed to decode the message
+type CodecError struct {
+	Err error
+}
+
+// Error implements error
+func (e *CodecError) Error() string {
+	return fmt.Sprintf("codec error: %s", e.Err)
+}
+
+// Unwrap returns the error returned by the codec
+func (e *CodecError) Unwrap() error {
+	return e.Err
+}
+
+// PanicError is the error of the recovered panic
+type PanicError struct {
+	Value any
+}
+
+// Error implements error
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// ErrorPolicy decides how NetApplication handles the panics and errors of the sessions. The
+// panics of the codec and the handleFunc are always recovered and logged with the stack,
+// the zero value closes the session on any panic or error.
+type ErrorPolicy[IN any, OUT any] struct {
+	// OnPanic is called with the session and the recovered value after a panic recovered
+	OnPanic func(rs IOSession[IN, OUT], value any)
+	// ContinueOnPanic continues reading the next message after the handleFunc panics. The
+	// session is always closed if the codec panics, because the read buffer may be broken.
+	ContinueOnPanic bool
+	// OnCodecError is called before the session closed if the codec failed to decode or
+	// panics, e.g. reply an error frame to the peer.
+	OnCodecError func(rs IOSession[IN, OUT], err *CodecError)
+	// OnHandlerError is called if the handleFunc returns an error, returns nil to continue
+	// reading the next message, otherwise the session is closed.
+	OnHandlerError func(rs IOSession[IN, OUT], msg IN, err error) error
+}
+
+// readMessage reads a message from the session, the panic of the codec is recovered and
+// returned as a CodecError.
+func (s *server[IN, OUT]) readMessage(rs IOSession[IN, OUT], logger *zap.Logger) (msg IN, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.onPanic(rs, logger, "session decode panic", r)
+			err = &CodecError{Err: &PanicError{Value: r}}
+		}
+	}()
+	return rs.Read(ReadOptions{})
+}
+
+// decodeMessage decodes a message from the in buffer of the session, the panic of the codec
+// is recovered and returned as a CodecError.
+func (s *server[IN, OUT]) decodeMessage(bio *baseIO[IN, OUT], logger *zap.Logger) (msg IN, complete bool, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.onPanic(bio, logger, "session decode panic", r)
+			err = &CodecError{Err: &PanicError{Value: r}}
+		}
+	}()
+	return bio.decode()
+}
+
+// handleMessage calls the handler, the panic of the handler is recovered and returned as a
+// PanicError.
+func (s *server[IN, OUT]) handleMessage(
+	handler InboundHandler[IN, OUT],
+	rs IOSession[IN, OUT],
+	msg IN,
+	received uint64,
+	logger *zap.Logger) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.onPanic(rs, logger, "session handle panic", r)
+			err = &PanicError{Value: r}
+		}
+	}()
+	return handler(rs, msg, received)
+}
+
+func (s *server[IN, OUT]) onPanic(rs IOSession[IN, OUT], logger *zap.Logger, msg string, value any) {
+	logger.Error(msg,
+		zap.Any("panic", value),
+		zap.Stack("stack"))
+	if s.options.errorPolicy.OnPanic != nil {
+		s.options.errorPolicy.OnPanic(rs, value)
+	}
+}
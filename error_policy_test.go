@@ -0,0 +1,169 @@
+package goetty
+
+import (
+	"errors"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fagongzi/goetty/v3/buf"
+	"github.com/fagongzi/goetty/v3/codec"
+	"github.com/fagongzi/goetty/v3/codec/simple"
+	"github.com/lni/goutils/leaktest"
+	"github.com/stretchr/testify/assert"
+)
+
+var errTestHandler = errors.New("handler error")
+
+func TestHandlerPanicClosesSession(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	panics := int32(0)
+	app := newTestAppWithCodec(t, []string{testUnixSocket}, handleTestErrorPolicyRequest,
+		&testErrorCodec{Codec: simple.NewStringCodec()},
+		WithAppErrorPolicy(ErrorPolicy[string, string]{
+			OnPanic: func(rs IOSession[string, string], value any) {
+				assert.Equal(t, "handler panic", value)
+				atomic.AddInt32(&panics, 1)
+			},
+		}))
+	assert.NoError(t, app.Start())
+	defer app.Stop()
+
+	rs := newTestIOSession(t)
+	defer rs.Close()
+	assert.NoError(t, rs.Connect(testUnixSocket, time.Second))
+	assert.NoError(t, rs.Write("panic", WriteOptions{Flush: true}))
+	_, err := rs.Read(ReadOptions{Timeout: time.Second})
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&panics))
+}
+
+func TestHandlerPanicContinue(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	app := newTestAppWithCodec(t, []string{testUnixSocket}, handleTestErrorPolicyRequest,
+		&testErrorCodec{Codec: simple.NewStringCodec()},
+		WithAppErrorPolicy(ErrorPolicy[string, string]{
+			ContinueOnPanic: true,
+			OnPanic: func(rs IOSession[string, string], value any) {
+				assert.NoError(t, rs.Write("panic-frame", WriteOptions{Flush: true}))
+			},
+		}))
+	assert.NoError(t, app.Start())
+	defer app.Stop()
+
+	rs := newTestIOSession(t)
+	defer rs.Close()
+	assert.NoError(t, rs.Connect(testUnixSocket, time.Second))
+	assert.NoError(t, rs.Write("panic", WriteOptions{Flush: true}))
+	reply, err := rs.Read(ReadOptions{Timeout: time.Second})
+	assert.NoError(t, err)
+	assert.Equal(t, "panic-frame", reply)
+	assertTestEcho(t, rs)
+}
+
+func TestHandlerError(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	app := newTestAppWithCodec(t, []string{testUnixSocket}, handleTestErrorPolicyRequest,
+		&testErrorCodec{Codec: simple.NewStringCodec()},
+		WithAppErrorPolicy(ErrorPolicy[string, string]{
+			OnHandlerError: func(rs IOSession[string, string], msg string, err error) error {
+				assert.Equal(t, errTestHandler, err)
+				return rs.Write("error-frame", WriteOptions{Flush: true})
+			},
+		}))
+	assert.NoError(t, app.Start())
+	defer app.Stop()
+
+	rs := newTestIOSession(t)
+	defer rs.Close()
+	assert.NoError(t, rs.Connect(testUnixSocket, time.Second))
+	assert.NoError(t, rs.Write("error", WriteOptions{Flush: true}))
+	reply, err := rs.Read(ReadOptions{Timeout: time.Second})
+	assert.NoError(t, err)
+	assert.Equal(t, "error-frame", reply)
+	assertTestEcho(t, rs)
+}
+
+func TestCodecError(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	panics := int32(0)
+	app := newTestAppWithCodec(t, []string{testUnixSocket}, handleTestErrorPolicyRequest,
+		&testErrorCodec{Codec: simple.NewStringCodec()},
+		WithAppErrorPolicy(ErrorPolicy[string, string]{
+			ContinueOnPanic: true,
+			OnPanic: func(rs IOSession[string, string], value any) {
+				atomic.AddInt32(&panics, 1)
+			},
+			OnCodecError: func(rs IOSession[string, string], err *CodecError) {
+				var pe *PanicError
+				if errors.As(err, &pe) {
+					assert.NoError(t, rs.Write("panic-frame", WriteOptions{Flush: true}))
+					return
+				}
+				assert.NoError(t, rs.Write("bad-frame", WriteOptions{Flush: true}))
+			},
+		}))
+	assert.NoError(t, app.Start())
+	defer app.Stop()
+
+	for _, c := range []struct {
+		msg    string
+		reply  string
+		panics int32
+	}{
+		{msg: "decode-error", reply: "bad-frame"},
+		{msg: "decode-panic", reply: "panic-frame", panics: 1},
+	} {
+		rs := newTestIOSession(t)
+		assert.NoError(t, rs.Connect(testUnixSocket, time.Second))
+		assert.NoError(t, rs.Write(c.msg, WriteOptions{Flush: true}))
+		reply, err := rs.Read(ReadOptions{Timeout: time.Second})
+		assert.NoError(t, err)
+		assert.Equal(t, c.reply, reply)
+		// the session is closed even if ContinueOnPanic
+		_, err = rs.Read(ReadOptions{Timeout: time.Second})
+		assert.Error(t, err)
+		assert.Equal(t, c.panics, atomic.LoadInt32(&panics))
+		assert.NoError(t, rs.Close())
+	}
+}
+
+// handleTestErrorPolicyRequest panics on the panic message, returns an error on the error
+// message, and echoes the others
+func handleTestErrorPolicyRequest(rs IOSession[string, string], msg string, received uint64) error {
+	switch msg {
+	case "panic":
+		panic("handler panic")
+	case "error":
+		return errTestHandler
+	}
+	return rs.Write(msg, WriteOptions{Flush: true})
+}
+
+// testErrorCodec fails to decode the decode-error and decode-panic messages
+type testErrorCodec struct {
+	codec.Codec[string, string]
+}
+
+func (c *testErrorCodec) Encode(msg string, out *buf.ByteBuf, conn io.Writer) error {
+	if msg == "encode-panic" {
+		panic("encode panic")
+	}
+	return c.Codec.Encode(msg, out, conn)
+}
+
+func (c *testErrorCodec) Decode(in *buf.ByteBuf) (string, bool, error) {
+	msg, complete, err := c.Codec.Decode(in)
+	switch msg {
+	case "decode-error":
+		return "", false, errors.New("bad frame")
+	case "decode-panic":
+		panic("decode panic")
+	}
+	return msg, complete, err
+}
@@ -0,0 +1,192 @@
+package goetty
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var (
+	errEventLoopNotSupported = errors.New("event loop is not supported on this platform")
+	errEventLoopStopped      = errors.New("event loop stopped")
+)
+
+// loopConn is a session whose reads are driven by an event loop instead of a goroutine. The
+// event loop reads the data into the in buffer of the session only when the fd is readable,
+// and decodes and handles the messages in the event loop goroutine, or hands them off to the
+// worker pool.
+type loopConn[IN any, OUT any] struct {
+	s        *server[IN, OUT]
+	conn     net.Conn
+	raw      syscall.RawConn
+	fd       int
+	bio      *baseIO[IN, OUT]
+	handler  InboundHandler[IN, OUT]
+	ws       *workerSession[IN, OUT]
+	logger   *zap.Logger
+	received uint64
+	// remove removes the conn from the event loop, and cleanups the session once the event
+	// loop will not touch it
+	remove func(lc *loopConn[IN, OUT], skip bool)
+
+	mu struct {
+		sync.Mutex
+		registered bool
+		finished   bool
+	}
+}
+
+// newLoopConn returns a loopConn if the conn can be driven by the event loop, the conn without
+// a file descriptor, e.g. tls.Conn, is not supported.
+func newLoopConn[IN any, OUT any](s *server[IN, OUT], conn net.Conn) (*loopConn[IN, OUT], bool) {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return nil, false
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return nil, false
+	}
+
+	lc := &loopConn[IN, OUT]{s: s, conn: conn, raw: raw}
+	if err := raw.Control(func(fd uintptr) {
+		lc.fd = int(fd)
+	}); err != nil {
+		return nil, false
+	}
+	return lc, true
+}
+
+// init init the loopConn with the created session
+func (lc *loopConn[IN, OUT]) init(bio *baseIO[IN, OUT]) {
+	lc.bio = bio
+	lc.logger = lc.s.logger.With(zap.Uint64("session-id", bio.ID()),
+		zap.String("addr", bio.RemoteAddress()))
+	lc.handler = lc.s.inboundHandler(bio)
+	if lc.s.workers != nil {
+		lc.ws = &workerSession[IN, OUT]{rs: bio, handler: lc.handler, logger: lc.logger, bio: bio}
+	}
+}
+
+// register registers the conn to the event loop by the add func, the add func is called with
+// the lock held to serialize with finish.
+func (lc *loopConn[IN, OUT]) register(add func(lc *loopConn[IN, OUT]) error) {
+	lc.mu.Lock()
+	if lc.mu.finished {
+		// the session is closed before registered
+		lc.mu.Unlock()
+		go lc.cleanup(true)
+		return
+	}
+	lc.mu.registered = true
+	err := add(lc)
+	lc.mu.Unlock()
+
+	if err != nil {
+		lc.logger.Error("register to event loop failed",
+			zap.Error(err))
+		lc.finish(true)
+	}
+}
+
+// finish stops handling the session, the queued messages of the worker pool are skipped if
+// skip is true. It is also called by the session before the conn closed.
+func (lc *loopConn[IN, OUT]) finish(skip bool) {
+	lc.mu.Lock()
+	if lc.mu.finished {
+		lc.mu.Unlock()
+		return
+	}
+	lc.mu.finished = true
+	registered := lc.mu.registered
+	lc.mu.Unlock()
+
+	if registered {
+		lc.remove(lc, skip)
+	}
+}
+
+func (lc *loopConn[IN, OUT]) isFinished() bool {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	return lc.mu.finished
+}
+
+// cleanup closes the session like the read goroutine does after the session handled
+func (lc *loopConn[IN, OUT]) cleanup(skip bool) {
+	defer lc.s.handlers.Done()
+	if lc.ws != nil {
+		lc.ws.close(skip)
+	}
+	lc.s.closeSession(lc.bio, lc.conn)
+}
+
+// onRead handles the data read from the conn, called in the event loop goroutine
+func (lc *loopConn[IN, OUT]) onRead(data []byte) {
+	bio := lc.bio
+	if _, err := bio.in.Write(data); err != nil {
+		lc.logger.Error("write to in buffer failed",
+			zap.Error(err))
+		lc.finish(true)
+		return
+	}
+	atomic.StoreInt64(&bio.atomic.lastRead, time.Now().UnixNano())
+
+	for !lc.isFinished() {
+		msg, complete, err := lc.s.decodeMessage(bio, lc.logger)
+		if err != nil {
+			var ce *CodecError
+			if errors.As(err, &ce) {
+				lc.logger.Error("session decode failed, close this session",
+					zap.Error(err))
+				if lc.s.options.errorPolicy.OnCodecError != nil {
+					lc.s.options.errorPolicy.OnCodecError(bio, ce)
+				}
+			}
+			lc.finish(true)
+			return
+		}
+		if !complete {
+			break
+		}
+		if bio.heartbeat != nil && bio.heartbeat.handle(msg) {
+			continue
+		}
+
+		lc.received++
+		if ce := lc.logger.Check(zap.DebugLevel, "session read message"); ce != nil {
+			ce.Write(zap.Uint64("sequence", lc.received))
+		}
+
+		if lc.ws != nil {
+			if err := lc.s.workers.dispatch(lc.ws, msg, lc.received); err != nil {
+				lc.logger.Error("dispatch message failed, close this session",
+					zap.Error(err))
+				lc.finish(true)
+				return
+			}
+			continue
+		}
+
+		err = lc.s.handleMessage(lc.handler, bio, msg, lc.received, lc.logger)
+		if err = lc.s.checkHandleError(bio, msg, err, lc.logger); err != nil {
+			lc.finish(true)
+			return
+		}
+	}
+
+	if !bio.options.disableAutoResetInBuffer && bio.in.Readable() == 0 {
+		bio.in.Reset()
+		// the data is read into the buffer of the event loop, so the buffers are only needed
+		// to hold the incomplete messages and the unflushed data
+		if bio.options.lazyBuffers {
+			bio.releaseBuffers()
+		}
+	}
+	atomic.StoreInt64(&bio.atomic.inBufSize, int64(bio.in.Capacity()))
+}
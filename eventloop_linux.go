@@ -0,0 +1,257 @@
+package goetty
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// eventLoopReadBufSize size of the buffer shared by the sessions of an event loop to read
+	eventLoopReadBufSize = 1024 * 64
+	// eventLoopMaxEvents max number of the events returned by an epoll wait
+	eventLoopMaxEvents = 256
+)
+
+// eventLoops is a group of epoll based event loops, the sessions are assigned to the event
+// loops in round robin.
+type eventLoops[IN any, OUT any] struct {
+	loops []*eventLoop[IN, OUT]
+	next  uint64
+}
+
+func newEventLoops[IN any, OUT any](s *server[IN, OUT], n int) (*eventLoops[IN, OUT], error) {
+	if n <= 0 {
+		n = runtime.NumCPU()
+	}
+
+	l := &eventLoops[IN, OUT]{}
+	for i := 0; i < n; i++ {
+		loop, err := newEventLoop(s)
+		if err != nil {
+			for _, loop := range l.loops {
+				loop.closeFDs()
+			}
+			return nil, err
+		}
+		l.loops = append(l.loops, loop)
+	}
+	return l, nil
+}
+
+func (l *eventLoops[IN, OUT]) start() {
+	for _, loop := range l.loops {
+		go loop.run()
+	}
+}
+
+func (l *eventLoops[IN, OUT]) stop() {
+	for _, loop := range l.loops {
+		loop.stop()
+	}
+}
+
+func (l *eventLoops[IN, OUT]) register(lc *loopConn[IN, OUT]) {
+	loop := l.loops[atomic.AddUint64(&l.next, 1)%uint64(len(l.loops))]
+	lc.remove = loop.remove
+	lc.register(loop.add)
+}
+
+type eventLoop[IN any, OUT any] struct {
+	logger *zap.Logger
+	epfd   int
+	wakefd int
+	buf    []byte
+	doneC  chan struct{}
+
+	mu struct {
+		sync.Mutex
+		stopped bool
+		conns   map[int]*loopConn[IN, OUT]
+		// closing the removed conns to be cleanup by the event loop
+		closing []closingConn[IN, OUT]
+	}
+}
+
+type closingConn[IN any, OUT any] struct {
+	lc   *loopConn[IN, OUT]
+	skip bool
+}
+
+func newEventLoop[IN any, OUT any](s *server[IN, OUT]) (*eventLoop[IN, OUT], error) {
+	epfd, err := unix.EpollCreate1(unix.EPOLL_CLOEXEC)
+	if err != nil {
+		return nil, err
+	}
+	wakefd, err := unix.Eventfd(0, unix.EFD_NONBLOCK|unix.EFD_CLOEXEC)
+	if err != nil {
+		unix.Close(epfd)
+		return nil, err
+	}
+	if err := unix.EpollCtl(epfd, unix.EPOLL_CTL_ADD, wakefd,
+		&unix.EpollEvent{Events: unix.EPOLLIN, Fd: int32(wakefd)}); err != nil {
+		unix.Close(wakefd)
+		unix.Close(epfd)
+		return nil, err
+	}
+
+	loop := &eventLoop[IN, OUT]{
+		logger: s.logger.Named("event-loop"),
+		epfd:   epfd,
+		wakefd: wakefd,
+		buf:    make([]byte, eventLoopReadBufSize),
+		doneC:  make(chan struct{}),
+	}
+	loop.mu.conns = make(map[int]*loopConn[IN, OUT])
+	return loop, nil
+}
+
+// add adds the conn to the epoll
+func (loop *eventLoop[IN, OUT]) add(lc *loopConn[IN, OUT]) error {
+	loop.mu.Lock()
+	defer loop.mu.Unlock()
+	if loop.mu.stopped {
+		return errEventLoopStopped
+	}
+
+	var err error
+	if cerr := lc.raw.Control(func(fd uintptr) {
+		err = unix.EpollCtl(loop.epfd, unix.EPOLL_CTL_ADD, int(fd),
+			&unix.EpollEvent{Events: unix.EPOLLIN | unix.EPOLLRDHUP, Fd: int32(fd)})
+	}); cerr != nil {
+		return cerr
+	}
+	if err != nil {
+		return err
+	}
+	loop.mu.conns[lc.fd] = lc
+	return nil
+}
+
+// remove removes the conn from the epoll before the conn closed, the session is cleanup by
+// the event loop goroutine, so that the in buffer is not used after closed.
+func (loop *eventLoop[IN, OUT]) remove(lc *loopConn[IN, OUT], skip bool) {
+	loop.mu.Lock()
+	if loop.mu.conns[lc.fd] == lc {
+		delete(loop.mu.conns, lc.fd)
+	}
+	if loop.mu.stopped {
+		loop.mu.Unlock()
+		go lc.cleanup(skip)
+		return
+	}
+
+	// the conn may be already closed, nothing to remove
+	_ = lc.raw.Control(func(fd uintptr) {
+		if err := unix.EpollCtl(loop.epfd, unix.EPOLL_CTL_DEL, int(fd), nil); err != nil {
+			loop.logger.Debug("remove from epoll failed",
+				zap.Error(err))
+		}
+	})
+	loop.mu.closing = append(loop.mu.closing, closingConn[IN, OUT]{lc: lc, skip: skip})
+	loop.mu.Unlock()
+	loop.wakeup()
+}
+
+func (loop *eventLoop[IN, OUT]) stop() {
+	loop.mu.Lock()
+	loop.mu.stopped = true
+	loop.mu.Unlock()
+	loop.wakeup()
+	<-loop.doneC
+	loop.closeFDs()
+}
+
+func (loop *eventLoop[IN, OUT]) wakeup() {
+	if _, err := unix.Write(loop.wakefd, []byte{1, 0, 0, 0, 0, 0, 0, 0}); err != nil &&
+		err != unix.EAGAIN {
+		loop.logger.Error("wakeup event loop failed",
+			zap.Error(err))
+	}
+}
+
+func (loop *eventLoop[IN, OUT]) closeFDs() {
+	unix.Close(loop.wakefd)
+	unix.Close(loop.epfd)
+}
+
+func (loop *eventLoop[IN, OUT]) run() {
+	defer close(loop.doneC)
+
+	events := make([]unix.EpollEvent, eventLoopMaxEvents)
+	for {
+		n, err := unix.EpollWait(loop.epfd, events, -1)
+		if err != nil {
+			if err == unix.EINTR {
+				continue
+			}
+			loop.logger.Error("epoll wait failed, event loop stopped",
+				zap.Error(err))
+			return
+		}
+
+		for i := 0; i < n; i++ {
+			fd := int(events[i].Fd)
+			if fd == loop.wakefd {
+				var v [8]byte
+				_, _ = unix.Read(loop.wakefd, v[:])
+				continue
+			}
+
+			loop.mu.Lock()
+			lc, ok := loop.mu.conns[fd]
+			loop.mu.Unlock()
+			if ok {
+				loop.read(lc)
+			}
+		}
+
+		if loop.cleanupClosing() {
+			return
+		}
+	}
+}
+
+// cleanupClosing cleanups the removed conns, returns true if the event loop is stopped
+func (loop *eventLoop[IN, OUT]) cleanupClosing() bool {
+	loop.mu.Lock()
+	closing := loop.mu.closing
+	loop.mu.closing = nil
+	stopped := loop.mu.stopped
+	loop.mu.Unlock()
+
+	for _, c := range closing {
+		go c.lc.cleanup(c.skip)
+	}
+	return stopped
+}
+
+// read reads the data from the readable conn
+func (loop *eventLoop[IN, OUT]) read(lc *loopConn[IN, OUT]) {
+	var n int
+	var err error
+	if cerr := lc.raw.Read(func(fd uintptr) bool {
+		n, err = unix.Read(int(fd), loop.buf)
+		return true
+	}); cerr != nil {
+		lc.finish(true)
+		return
+	}
+
+	switch {
+	case err == unix.EAGAIN || err == unix.EINTR:
+		return
+	case err != nil:
+		lc.logger.Info("session read failed",
+			zap.Error(err))
+		lc.finish(true)
+		return
+	case n == 0:
+		lc.finish(false)
+		return
+	}
+	lc.onRead(loop.buf[:n])
+}
@@ -0,0 +1,214 @@
+package goetty
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lni/goutils/leaktest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventLoop(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	for name, opts := range map[string][]AppOption[string, string]{
+		"inline":      {WithAppEventLoop[string, string](2)},
+		"worker-pool": {WithAppEventLoop[string, string](2), WithAppWorkerPool[string, string](WorkerPoolConfig{Workers: 2})},
+	} {
+		appOpts := opts
+		t.Run(name, func(t *testing.T) {
+			app := newTestApp(t,
+				testListenAddresses,
+				func(rs IOSession[string, string], msg string, received uint64) error {
+					if msg == "close" {
+						return rs.Disconnect()
+					}
+					return rs.Write(fmt.Sprintf("%d:%s", received, msg), WriteOptions{Flush: true})
+				},
+				appOpts...)
+			assert.NoError(t, app.Start())
+			defer app.Stop()
+			if runtime.GOOS == "linux" {
+				assert.NotNil(t, app.(*server[string, string]).loops)
+			}
+
+			var wg sync.WaitGroup
+			for _, address := range testAddresses {
+				for i := 0; i < 5; i++ {
+					wg.Add(1)
+					go func(addr string) {
+						defer wg.Done()
+						rs := newTestIOSession(t)
+						defer rs.Close()
+						assert.NoError(t, rs.Connect(addr, time.Second))
+
+						n := 20
+						for j := 1; j <= n; j++ {
+							assert.NoError(t, rs.Write(fmt.Sprintf("hello-%d", j), WriteOptions{}))
+						}
+						assert.NoError(t, rs.Flush(time.Second))
+						for j := 1; j <= n; j++ {
+							reply, err := rs.Read(ReadOptions{Timeout: time.Second})
+							assert.NoError(t, err)
+							assert.Equal(t, fmt.Sprintf("%d:hello-%d", j, j), reply)
+						}
+
+						assert.NoError(t, rs.Write("close", WriteOptions{Flush: true}))
+						_, err := rs.Read(ReadOptions{Timeout: time.Second})
+						assert.Error(t, err)
+					}(address)
+				}
+			}
+			wg.Wait()
+			assert.Eventually(t, func() bool {
+				return app.Count() == 0
+			}, time.Second, time.Millisecond*10)
+		})
+	}
+}
+
+func TestEventLoopMemoryStats(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	if runtime.GOOS != "linux" {
+		t.Skip("event loop is only supported on linux")
+	}
+
+	for name, opts := range map[string][]AppOption[string, string]{
+		"goroutine":   nil,
+		"inline":      {WithAppEventLoop[string, string](1)},
+		"worker-pool": {WithAppEventLoop[string, string](1), WithAppWorkerPool[string, string](WorkerPoolConfig{Workers: 1})},
+	} {
+		appOpts := opts
+		eventLoop := len(opts) > 0
+		t.Run(name, func(t *testing.T) {
+			app := newTestApp(t,
+				[]string{testUnixSocket},
+				func(rs IOSession[string, string], msg string, received uint64) error {
+					return rs.Write(msg, WriteOptions{Flush: true})
+				},
+				appOpts...)
+			assert.NoError(t, app.Start())
+			defer app.Stop()
+
+			for i := 0; i < 3; i++ {
+				rs := newTestIOSession(t)
+				defer rs.Close()
+				assert.NoError(t, rs.Connect(testUnixSocket, time.Second))
+				assertTestEcho(t, rs)
+			}
+
+			total := func() int {
+				v := 0
+				app.Range(func(rs IOSession[string, string]) bool {
+					v += rs.(MemoryStatsAware).MemoryStats().Total()
+					return true
+				})
+				return v
+			}
+			if !eventLoop {
+				assert.True(t, total() >= 3*(defaultReadBuf+defaultWriteBuf))
+				return
+			}
+			// the idle sessions of the event loop hold no buffers
+			assert.Eventually(t, func() bool {
+				return total() == 0
+			}, time.Second, time.Millisecond*10)
+		})
+	}
+}
+
+func TestEventLoopStop(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	app := newTestApp(t,
+		testListenAddresses,
+		func(rs IOSession[string, string], msg string, received uint64) error {
+			return rs.Write(msg, WriteOptions{Flush: true})
+		},
+		WithAppEventLoop[string, string](1))
+	assert.NoError(t, app.Start())
+
+	var sessions []IOSession[string, string]
+	for _, address := range testAddresses {
+		rs := newTestIOSession(t)
+		assert.NoError(t, rs.Connect(address, time.Second))
+		assertTestEcho(t, rs)
+		sessions = append(sessions, rs)
+	}
+	assert.Equal(t, 2, app.Count())
+
+	assert.NoError(t, app.Stop())
+	for _, rs := range sessions {
+		_, err := rs.Read(ReadOptions{Timeout: time.Second})
+		assert.Error(t, err)
+		assert.NoError(t, rs.Close())
+	}
+	s := app.(*server[string, string])
+	s.handlers.Wait()
+}
+
+func TestEventLoopWorkerQueueFull(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	releaseC := make(chan struct{})
+	app := newTestApp(t,
+		[]string{testUnixSocket},
+		func(rs IOSession[string, string], msg string, received uint64) error {
+			if msg == "block" {
+				<-releaseC
+				return nil
+			}
+			return rs.Write(msg, WriteOptions{Flush: true})
+		},
+		WithAppEventLoop[string, string](1),
+		WithAppWorkerPool[string, string](WorkerPoolConfig{
+			Workers:      2,
+			QueueSize:    1,
+			Backpressure: BackpressureBlock,
+		}))
+	assert.NoError(t, app.Start())
+	defer app.Stop()
+	defer close(releaseC)
+
+	// the sessions are dispatched to different workers by the session id
+	rs1 := newTestIOSession(t)
+	defer rs1.Close()
+	assert.NoError(t, rs1.Connect(testUnixSocket, time.Second))
+	rs2 := newTestIOSession(t)
+	defer rs2.Close()
+	assert.NoError(t, rs2.Connect(testUnixSocket, time.Second))
+
+	// the worker queue of rs1 is full, rs1 is closed instead of blocking the event loop
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, rs1.Write("block", WriteOptions{Flush: true}))
+	}
+	assertTestEcho(t, rs2)
+}
+
+func TestEventLoopIdleTimeout(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	app := newTestApp(t,
+		[]string{testUnixSocket},
+		func(rs IOSession[string, string], msg string, received uint64) error {
+			return rs.Write(msg, WriteOptions{Flush: true})
+		},
+		WithAppEventLoop[string, string](1),
+		WithAppIdleTimeout[string, string](0, 0, time.Millisecond*50))
+	assert.NoError(t, app.Start())
+	defer app.Stop()
+
+	rs := newTestIOSession(t)
+	defer rs.Close()
+	assert.NoError(t, rs.Connect(testUnixSocket, time.Second))
+	assertTestEcho(t, rs)
+	_, err := rs.Read(ReadOptions{Timeout: time.Second})
+	assert.Error(t, err)
+	assert.False(t, isTimeoutErr(err))
+	assert.Eventually(t, func() bool {
+		return app.Count() == 0
+	}, time.Second, time.Millisecond*10)
+}
@@ -0,0 +1,14 @@
+package goetty
+
+// eventLoops is not supported on this platform, the sessions are handled by goroutines
+type eventLoops[IN any, OUT any] struct{}
+
+func newEventLoops[IN any, OUT any](s *server[IN, OUT], n int) (*eventLoops[IN, OUT], error) {
+	return nil, errEventLoopNotSupported
+}
+
+func (l *eventLoops[IN, OUT]) start() {}
+
+func (l *eventLoops[IN, OUT]) stop() {}
+
+func (l *eventLoops[IN, OUT]) register(lc *loopConn[IN, OUT]) {}
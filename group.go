@@ -0,0 +1,278 @@
+package goetty
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// SessionGroupsOption option to create SessionGroups
+type SessionGroupsOption[IN any, OUT any] func(*sessionGroups[IN, OUT])
+
+// WithSessionGroupsBroadcast set the max number of sessions written concurrently and the
+// write timeout of each session for SessionGroup.Broadcast, 0 timeout means no timeout.
+func WithSessionGroupsBroadcast[IN any, OUT any](concurrency int, timeout time.Duration) SessionGroupsOption[IN, OUT] {
+	return func(g *sessionGroups[IN, OUT]) {
+		g.options.broadcastConcurrency = concurrency
+		g.options.broadcastTimeout = timeout
+	}
+}
+
+// SessionGroups manages the named groups of sessions. It implements IOSessionAware to
+// remove the closed sessions from all groups, so it must be set to the sessions by
+// WithAppSessionAware or WithSessionAware, use ChainSessionAware to combine it with other
+// IOSessionAware.
+type SessionGroups[IN any, OUT any] interface {
+	IOSessionAware[IN, OUT]
+
+	// Join adds the session to the named group, the group is created if not exists. Returns
+	// false if the session is not connected, since the closed session will not be removed.
+	Join(name string, rs IOSession[IN, OUT]) bool
+	// Leave removes the session from the named group, the group is removed if empty
+	Leave(name string, rs IOSession[IN, OUT])
+	// LeaveAll removes the session from all groups
+	LeaveAll(rs IOSession[IN, OUT])
+	// Get returns the named group, the returned group is detached once it becomes empty and
+	// removed, so do not hold it for a long time.
+	Get(name string) (SessionGroup[IN, OUT], bool)
+	// Groups returns the sorted names of all groups
+	Groups() []string
+	// Joined returns the sorted names of the groups which the session joined
+	Joined(rs IOSession[IN, OUT]) []string
+}
+
+// SessionGroup is a named group of sessions
+type SessionGroup[IN any, OUT any] interface {
+	// Name returns the name of the group
+	Name() string
+	// Len returns the number of the sessions in the group
+	Len() int
+	// Contains returns true if the session with the id is in the group
+	Contains(id uint64) bool
+	// Range calls fn for each session in the group, stops the iteration if fn returns false.
+	// The sessions can join or leave the group in fn.
+	Range(fn func(IOSession[IN, OUT]) bool)
+	// Write writes the msg to all sessions in the group one by one. Returns the errors of the
+	// failed sessions keyed by session id.
+	Write(msg OUT, options WriteOptions) map[uint64]error
+	// Broadcast writes and flushes the msg to the sessions in the group matched by the filter
+	// concurrently, nil filter matches all sessions. Returns the errors of the failed sessions
+	// keyed by session id.
+	Broadcast(msg OUT, filter func(IOSession[IN, OUT]) bool) map[uint64]error
+}
+
+type sessionGroups[IN any, OUT any] struct {
+	mu struct {
+		sync.RWMutex
+		groups map[string]*sessionGroup[IN, OUT]
+		// joined session id -> names of the joined groups
+		joined map[uint64]map[string]struct{}
+	}
+
+	options struct {
+		broadcastConcurrency int
+		broadcastTimeout     time.Duration
+	}
+}
+
+// NewSessionGroups returns a SessionGroups
+func NewSessionGroups[IN any, OUT any](opts ...SessionGroupsOption[IN, OUT]) SessionGroups[IN, OUT] {
+	g := &sessionGroups[IN, OUT]{}
+	for _, opt := range opts {
+		opt(g)
+	}
+	g.adjust()
+	g.mu.groups = make(map[string]*sessionGroup[IN, OUT])
+	g.mu.joined = make(map[uint64]map[string]struct{})
+	return g
+}
+
+func (g *sessionGroups[IN, OUT]) adjust() {
+	if g.options.broadcastConcurrency <= 0 {
+		g.options.broadcastConcurrency = defaultBroadcastConcurrency
+	}
+}
+
+func (g *sessionGroups[IN, OUT]) Created(rs IOSession[IN, OUT]) {}
+
+func (g *sessionGroups[IN, OUT]) Closed(rs IOSession[IN, OUT]) {
+	g.LeaveAll(rs)
+}
+
+func (g *sessionGroups[IN, OUT]) Join(name string, rs IOSession[IN, OUT]) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	// the state is changed before Closed called, which waits for the lock to leave all groups
+	if !rs.Connected() {
+		return false
+	}
+
+	group, ok := g.mu.groups[name]
+	if !ok {
+		group = newSessionGroup(g, name)
+		g.mu.groups[name] = group
+	}
+	group.add(rs)
+
+	names, ok := g.mu.joined[rs.ID()]
+	if !ok {
+		names = make(map[string]struct{})
+		g.mu.joined[rs.ID()] = names
+	}
+	names[name] = struct{}{}
+	return true
+}
+
+func (g *sessionGroups[IN, OUT]) Leave(name string, rs IOSession[IN, OUT]) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.leaveLocked(name, rs.ID())
+	if names, ok := g.mu.joined[rs.ID()]; ok {
+		delete(names, name)
+		if len(names) == 0 {
+			delete(g.mu.joined, rs.ID())
+		}
+	}
+}
+
+func (g *sessionGroups[IN, OUT]) LeaveAll(rs IOSession[IN, OUT]) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for name := range g.mu.joined[rs.ID()] {
+		g.leaveLocked(name, rs.ID())
+	}
+	delete(g.mu.joined, rs.ID())
+}
+
+func (g *sessionGroups[IN, OUT]) Get(name string) (SessionGroup[IN, OUT], bool) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	group, ok := g.mu.groups[name]
+	if !ok {
+		return nil, false
+	}
+	return group, true
+}
+
+func (g *sessionGroups[IN, OUT]) Groups() []string {
+	g.mu.RLock()
+	names := make([]string, 0, len(g.mu.groups))
+	for name := range g.mu.groups {
+		names = append(names, name)
+	}
+	g.mu.RUnlock()
+
+	sort.Strings(names)
+	return names
+}
+
+func (g *sessionGroups[IN, OUT]) Joined(rs IOSession[IN, OUT]) []string {
+	g.mu.RLock()
+	joined := g.mu.joined[rs.ID()]
+	names := make([]string, 0, len(joined))
+	for name := range joined {
+		names = append(names, name)
+	}
+	g.mu.RUnlock()
+
+	sort.Strings(names)
+	return names
+}
+
+func (g *sessionGroups[IN, OUT]) leaveLocked(name string, id uint64) {
+	group, ok := g.mu.groups[name]
+	if !ok {
+		return
+	}
+	if group.remove(id) == 0 {
+		delete(g.mu.groups, name)
+	}
+}
+
+type sessionGroup[IN any, OUT any] struct {
+	groups *sessionGroups[IN, OUT]
+	name   string
+
+	mu struct {
+		sync.RWMutex
+		sessions map[uint64]IOSession[IN, OUT]
+	}
+}
+
+func newSessionGroup[IN any, OUT any](groups *sessionGroups[IN, OUT], name string) *sessionGroup[IN, OUT] {
+	group := &sessionGroup[IN, OUT]{
+		groups: groups,
+		name:   name,
+	}
+	group.mu.sessions = make(map[uint64]IOSession[IN, OUT])
+	return group
+}
+
+func (group *sessionGroup[IN, OUT]) Name() string {
+	return group.name
+}
+
+func (group *sessionGroup[IN, OUT]) Len() int {
+	group.mu.RLock()
+	defer group.mu.RUnlock()
+	return len(group.mu.sessions)
+}
+
+func (group *sessionGroup[IN, OUT]) Contains(id uint64) bool {
+	group.mu.RLock()
+	defer group.mu.RUnlock()
+	_, ok := group.mu.sessions[id]
+	return ok
+}
+
+func (group *sessionGroup[IN, OUT]) Range(fn func(IOSession[IN, OUT]) bool) {
+	for _, rs := range group.snapshot() {
+		if !fn(rs) {
+			return
+		}
+	}
+}
+
+func (group *sessionGroup[IN, OUT]) Write(msg OUT, options WriteOptions) map[uint64]error {
+	errors := make(map[uint64]error)
+	for _, rs := range group.snapshot() {
+		if err := rs.Write(msg, options); err != nil {
+			errors[rs.ID()] = err
+		}
+	}
+	return errors
+}
+
+func (group *sessionGroup[IN, OUT]) Broadcast(msg OUT, filter func(IOSession[IN, OUT]) bool) map[uint64]error {
+	return broadcast(group.Range, msg, filter,
+		group.groups.options.broadcastConcurrency,
+		group.groups.options.broadcastTimeout)
+}
+
+func (group *sessionGroup[IN, OUT]) add(rs IOSession[IN, OUT]) {
+	group.mu.Lock()
+	defer group.mu.Unlock()
+	group.mu.sessions[rs.ID()] = rs
+}
+
+// remove removes the session, and returns the number of the remaining sessions
+func (group *sessionGroup[IN, OUT]) remove(id uint64) int {
+	group.mu.Lock()
+	defer group.mu.Unlock()
+	delete(group.mu.sessions, id)
+	return len(group.mu.sessions)
+}
+
+func (group *sessionGroup[IN, OUT]) snapshot() []IOSession[IN, OUT] {
+	group.mu.RLock()
+	defer group.mu.RUnlock()
+	sessions := make([]IOSession[IN, OUT], 0, len(group.mu.sessions))
+	for _, rs := range group.mu.sessions {
+		sessions = append(sessions, rs)
+	}
+	return sessions
+}
@@ -0,0 +1,134 @@
+package goetty
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lni/goutils/leaktest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionGroups(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	groups := NewSessionGroups[string, string]()
+	app := newTestApp(t,
+		testListenAddresses,
+		func(rs IOSession[string, string], msg string, received uint64) error {
+			switch {
+			case strings.HasPrefix(msg, "join:"):
+				groups.Join(msg[5:], rs)
+			case strings.HasPrefix(msg, "leave:"):
+				groups.Leave(msg[6:], rs)
+			case msg == "joined":
+				return rs.Write(strings.Join(groups.Joined(rs), ","), WriteOptions{Flush: true})
+			}
+			return rs.Write("ok", WriteOptions{Flush: true})
+		},
+		WithAppSessionAware[string, string](groups))
+	assert.NoError(t, app.Start())
+	defer app.Stop()
+
+	c1 := newTestGroupsClient(t, "a", "b")
+	defer c1.Close()
+	c2 := newTestGroupsClient(t, "a")
+	defer c2.Close()
+	c3 := newTestGroupsClient(t, "b")
+	defer c3.Close()
+	assert.Equal(t, []string{"a", "b"}, groups.Groups())
+
+	assert.NoError(t, c1.Write("joined", WriteOptions{Flush: true}))
+	reply, err := c1.Read(ReadOptions{Timeout: time.Second})
+	assert.NoError(t, err)
+	assert.Equal(t, "a,b", reply)
+
+	a, ok := groups.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, "a", a.Name())
+	assert.Equal(t, 2, a.Len())
+	assert.Empty(t, a.Broadcast("hello-a", nil))
+	for _, c := range []IOSession[string, string]{c1, c2} {
+		msg, err := c.Read(ReadOptions{Timeout: time.Second})
+		assert.NoError(t, err)
+		assert.Equal(t, "hello-a", msg)
+	}
+
+	b, ok := groups.Get("b")
+	assert.True(t, ok)
+	assert.Empty(t, b.Write("hello-b", WriteOptions{Flush: true}))
+	for _, c := range []IOSession[string, string]{c1, c3} {
+		msg, err := c.Read(ReadOptions{Timeout: time.Second})
+		assert.NoError(t, err)
+		assert.Equal(t, "hello-b", msg)
+	}
+
+	// the closed session leaves all groups
+	assert.NoError(t, c1.Disconnect())
+	assert.Eventually(t, func() bool {
+		return a.Len() == 1 && b.Len() == 1
+	}, time.Second, time.Millisecond*10)
+
+	// the empty group is removed
+	assert.NoError(t, c2.Write("leave:a", WriteOptions{Flush: true}))
+	reply, err = c2.Read(ReadOptions{Timeout: time.Second})
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", reply)
+	_, ok = groups.Get("a")
+	assert.False(t, ok)
+	assert.Equal(t, []string{"b"}, groups.Groups())
+}
+
+func TestSessionGroupsJoinClosedSession(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	app := newTestApp(t, []string{testUnixSocket}, nil)
+	assert.NoError(t, app.Start())
+	defer app.Stop()
+
+	groups := NewSessionGroups[string, string]()
+	rs := newTestIOSession(t, WithSessionAware(IOSessionAware[string, string](groups)))
+	assert.False(t, groups.Join("a", rs))
+	assert.NoError(t, rs.Connect(testUnixSocket, time.Second))
+	assert.True(t, groups.Join("a", rs))
+	assert.Equal(t, []string{"a"}, groups.Groups())
+	assert.NoError(t, rs.Close())
+	assert.Empty(t, groups.Groups())
+	assert.False(t, groups.Join("a", rs))
+	assert.Empty(t, groups.Groups())
+	assert.Empty(t, groups.Joined(rs))
+}
+
+func TestChainSessionAware(t *testing.T) {
+	var events []string
+	newAware := func(name string) IOSessionAware[string, string] {
+		return &testSessionAware{
+			created: func() { events = append(events, name+"-created") },
+			closed:  func() { events = append(events, name+"-closed") },
+		}
+	}
+
+	rs := newTestIOSession(t, WithSessionAware(ChainSessionAware(newAware("a"), newAware("b"))))
+	assert.NoError(t, rs.Close())
+	assert.Equal(t, []string{"a-created", "b-created", "a-closed", "b-closed"}, events)
+}
+
+type testSessionAware struct {
+	created func()
+	closed  func()
+}
+
+func (a *testSessionAware) Created(IOSession[string, string]) { a.created() }
+func (a *testSessionAware) Closed(IOSession[string, string])  { a.closed() }
+
+func newTestGroupsClient(t *testing.T, names ...string) IOSession[string, string] {
+	rs := newTestIOSession(t)
+	assert.NoError(t, rs.Connect(testUnixSocket, time.Second))
+	for _, name := range names {
+		assert.NoError(t, rs.Write("join:"+name, WriteOptions{Flush: true}))
+		reply, err := rs.Read(ReadOptions{Timeout: time.Second})
+		assert.NoError(t, err)
+		assert.Equal(t, "ok", reply)
+	}
+	return rs
+}
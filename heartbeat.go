@@ -0,0 +1,145 @@
+package goetty
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var (
+	errHeartbeatMissed = errors.New("heartbeat missed")
+)
+
+// HeartbeatFactory is used to build and recognize the heartbeat messages of the protocol
+type HeartbeatFactory[IN any, OUT any] interface {
+	// NewPing returns a ping message
+	NewPing() OUT
+	// NewPong returns a pong message to reply the received ping message
+	NewPong(ping IN) OUT
+	// IsPing returns true if the received message is a ping message
+	IsPing(msg IN) bool
+	// IsPong returns true if the received message is a pong message
+	IsPong(msg IN) bool
+}
+
+// heartbeat sends a ping message if nothing was read from the IOSession in the interval,
+// and disconnects the IOSession if nothing was read after maxMissed pings sent. The ping
+// and pong messages are handled in IOSession.Read, and never returned to the caller.
+type heartbeat[IN any, OUT any] struct {
+	bio       *baseIO[IN, OUT]
+	factory   HeartbeatFactory[IN, OUT]
+	interval  time.Duration
+	maxMissed int
+
+	mu struct {
+		sync.Mutex
+		running bool
+		stopC   chan struct{}
+		doneC   chan struct{}
+	}
+}
+
+func newHeartbeat[IN any, OUT any](
+	bio *baseIO[IN, OUT],
+	factory HeartbeatFactory[IN, OUT],
+	interval time.Duration,
+	maxMissed int) *heartbeat[IN, OUT] {
+	return &heartbeat[IN, OUT]{
+		bio:       bio,
+		factory:   factory,
+		interval:  interval,
+		maxMissed: maxMissed,
+	}
+}
+
+func (hb *heartbeat[IN, OUT]) start() {
+	if hb.interval <= 0 {
+		return
+	}
+
+	hb.mu.Lock()
+	defer hb.mu.Unlock()
+	if hb.mu.running {
+		return
+	}
+
+	hb.mu.running = true
+	hb.mu.stopC = make(chan struct{})
+	hb.mu.doneC = make(chan struct{})
+	go hb.run(hb.mu.stopC, hb.mu.doneC)
+}
+
+func (hb *heartbeat[IN, OUT]) stop() {
+	hb.mu.Lock()
+	if !hb.mu.running {
+		hb.mu.Unlock()
+		return
+	}
+	hb.mu.running = false
+	close(hb.mu.stopC)
+	doneC := hb.mu.doneC
+	hb.mu.Unlock()
+	<-doneC
+}
+
+func (hb *heartbeat[IN, OUT]) run(stopC, doneC chan struct{}) {
+	defer close(doneC)
+
+	ticker := time.NewTicker(hb.interval)
+	defer ticker.Stop()
+
+	missed := 0
+	lastSeen, _ := hb.bio.activeTime()
+	for {
+		select {
+		case <-stopC:
+			return
+		case now := <-ticker.C:
+			lastRead, _ := hb.bio.activeTime()
+			if lastRead != lastSeen {
+				missed = 0
+				lastSeen = lastRead
+			}
+			if now.UnixNano()-lastRead < int64(hb.interval) {
+				continue
+			}
+
+			if missed >= hb.maxMissed {
+				hb.bio.logger.Info("heartbeat missed, disconnect the session",
+					zap.Int("missed", missed),
+					zap.String("addr", hb.bio.RemoteAddress()))
+				if hb.bio.reconnector != nil {
+					hb.bio.reconnector.trigger(errHeartbeatMissed)
+				} else {
+					// Disconnect will wait for the heartbeat goroutine to stop
+					go hb.bio.Disconnect()
+				}
+				return
+			}
+
+			missed++
+			if err := hb.bio.Write(hb.factory.NewPing(), WriteOptions{Flush: true, Timeout: hb.interval}); err != nil {
+				hb.bio.logger.Debug("send ping failed",
+					zap.Error(err))
+			}
+		}
+	}
+}
+
+// handle handles the ping and pong messages, returns true if the msg is a heartbeat
+// message which should not be returned to the caller.
+func (hb *heartbeat[IN, OUT]) handle(msg IN) bool {
+	if hb.factory.IsPong(msg) {
+		return true
+	}
+	if hb.factory.IsPing(msg) {
+		if err := hb.bio.Write(hb.factory.NewPong(msg), WriteOptions{Flush: true}); err != nil {
+			hb.bio.logger.Debug("send pong failed",
+				zap.Error(err))
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+package goetty
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lni/goutils/leaktest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeartbeatKeepAlive(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	for name, address := range testAddresses {
+		addr := address
+		t.Run(name, func(t *testing.T) {
+			app := newTestApp(t, testListenAddresses,
+				func(rs IOSession[string, string], msg string, received uint64) error {
+					return rs.Write(msg, WriteOptions{Flush: true})
+				},
+				WithAppSessionOptions(WithSessionHeartbeat[string, string](&testHeartbeatFactory{}, 0, 0)))
+			assert.NoError(t, app.Start())
+			defer app.Stop()
+
+			client := newTestIOSession(t,
+				WithSessionHeartbeat[string, string](&testHeartbeatFactory{}, time.Millisecond*20, 2))
+			defer client.Close()
+			assert.NoError(t, client.Connect(addr, time.Second))
+
+			readC := make(chan string, 1)
+			go func() {
+				defer close(readC)
+				for {
+					msg, err := client.Read(ReadOptions{})
+					if err != nil {
+						return
+					}
+					readC <- msg
+				}
+			}()
+
+			time.Sleep(time.Millisecond * 200)
+			assert.True(t, client.Connected())
+			assert.NoError(t, client.Write("hello", WriteOptions{Flush: true}))
+			assert.Equal(t, "hello", <-readC)
+			assert.NoError(t, client.Disconnect())
+			for range readC {
+			}
+		})
+	}
+}
+
+func TestHeartbeatMissed(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	app := newTestApp(t, []string{testUnixSocket}, nil,
+		WithAppSessionOptions(
+			WithSessionHeartbeat[string, string](&testHeartbeatFactory{}, time.Millisecond*20, 2)))
+	assert.NoError(t, app.Start())
+	defer app.Stop()
+
+	client := newTestIOSession(t)
+	defer client.Close()
+	assert.NoError(t, client.Connect(testUnixSocket, time.Second))
+
+	pings := 0
+	for {
+		msg, err := client.Read(ReadOptions{Timeout: time.Second * 5})
+		if err != nil {
+			break
+		}
+		assert.Equal(t, "ping", msg)
+		pings++
+	}
+	assert.Equal(t, 2, pings)
+}
+
+type testHeartbeatFactory struct {
+}
+
+func (f *testHeartbeatFactory) NewPing() string {
+	return "ping"
+}
+
+func (f *testHeartbeatFactory) NewPong(ping string) string {
+	return "pong"
+}
+
+func (f *testHeartbeatFactory) IsPing(msg string) bool {
+	return msg == "ping"
+}
+
+func (f *testHeartbeatFactory) IsPong(msg string) bool {
+	return msg == "pong"
+}
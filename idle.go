@@ -0,0 +1,143 @@
+package goetty
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	minIdleCheckInterval = time.Millisecond * 10
+)
+
+type activeTimeRecorder interface {
+	// activeTime returns the unix nano of the last successful read and write
+	activeTime() (int64, int64)
+}
+
+// idleChecker periodically checks all sessions of the application, and fires the
+// IdleState events for the sessions which have no read or write activity for the
+// configured timeouts.
+type idleChecker[IN any, OUT any] struct {
+	s        *server[IN, OUT]
+	logger   *zap.Logger
+	interval time.Duration
+	timeouts [3]time.Duration
+	// fired records the last time the IdleState events were fired for the sessions
+	fired    map[uint64][3]int64
+	sessions []IOSession[IN, OUT]
+	stopC    chan struct{}
+	doneC    chan struct{}
+}
+
+func newIdleChecker[IN any, OUT any](s *server[IN, OUT]) *idleChecker[IN, OUT] {
+	ic := &idleChecker[IN, OUT]{
+		s:      s,
+		logger: s.logger.Named("idle"),
+		fired:  make(map[uint64][3]int64),
+	}
+	ic.timeouts[ReaderIdle] = s.options.readIdleTimeout
+	ic.timeouts[WriterIdle] = s.options.writeIdleTimeout
+	ic.timeouts[AllIdle] = s.options.allIdleTimeout
+	for _, timeout := range ic.timeouts {
+		if timeout > 0 && (ic.interval == 0 || timeout/2 < ic.interval) {
+			ic.interval = timeout / 2
+		}
+	}
+	if ic.interval < minIdleCheckInterval {
+		ic.interval = minIdleCheckInterval
+	}
+	return ic
+}
+
+func (ic *idleChecker[IN, OUT]) start() {
+	ic.stopC = make(chan struct{})
+	ic.doneC = make(chan struct{})
+	go ic.run()
+}
+
+func (ic *idleChecker[IN, OUT]) stop() {
+	close(ic.stopC)
+	<-ic.doneC
+}
+
+func (ic *idleChecker[IN, OUT]) run() {
+	defer close(ic.doneC)
+
+	ticker := time.NewTicker(ic.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ic.stopC:
+			return
+		case now := <-ticker.C:
+			ic.check(now.UnixNano())
+		}
+	}
+}
+
+func (ic *idleChecker[IN, OUT]) check(now int64) {
+	ic.sessions = ic.sessions[:0]
+	for _, m := range ic.s.sessions {
+		m.RLock()
+		for _, rs := range m.sessions {
+			ic.sessions = append(ic.sessions, rs)
+		}
+		m.RUnlock()
+	}
+
+	fired := make(map[uint64][3]int64, len(ic.sessions))
+	for idx, rs := range ic.sessions {
+		ic.sessions[idx] = nil
+		recorder, ok := rs.(activeTimeRecorder)
+		if !ok {
+			continue
+		}
+
+		lastRead, lastWrite := recorder.activeTime()
+		last := [3]int64{lastRead, lastWrite, lastRead}
+		if lastWrite > lastRead {
+			last[AllIdle] = lastWrite
+		}
+
+		records := ic.fired[rs.ID()]
+		for state, timeout := range ic.timeouts {
+			if timeout <= 0 {
+				continue
+			}
+
+			since := last[state]
+			if records[state] > since {
+				since = records[state]
+			}
+			if now-since < int64(timeout) {
+				continue
+			}
+
+			records[state] = now
+			if ic.fire(rs, IdleState(state)) {
+				break
+			}
+		}
+		fired[rs.ID()] = records
+	}
+	ic.fired = fired
+}
+
+// fire fires the IdleState event, returns true if the session is closed
+func (ic *idleChecker[IN, OUT]) fire(rs IOSession[IN, OUT], state IdleState) bool {
+	if aware := ic.s.options.idleAware; aware != nil && !aware.Idle(rs, state) {
+		return false
+	}
+
+	ic.logger.Info("session idle, close it",
+		zap.Uint64("session-id", rs.ID()),
+		zap.String("addr", rs.RemoteAddress()),
+		zap.Stringer("state", state))
+	if err := rs.Disconnect(); err != nil {
+		ic.logger.Error("close idle session failed",
+			zap.Uint64("session-id", rs.ID()),
+			zap.Error(err))
+	}
+	return true
+}
@@ -0,0 +1,89 @@
+package goetty
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lni/goutils/leaktest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdleSessionClosed(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	for name, address := range testAddresses {
+		addr := address
+		t.Run(name, func(t *testing.T) {
+			app := newTestApp(t,
+				testListenAddresses,
+				func(rs IOSession[string, string], msg string, received uint64) error {
+					return rs.Write(msg, WriteOptions{Flush: true})
+				},
+				WithAppIdleTimeout[string, string](time.Millisecond*100, 0, 0))
+			assert.NoError(t, app.Start())
+			defer app.Stop()
+
+			client := newTestIOSession(t)
+			defer client.Close()
+			assert.NoError(t, client.Connect(addr, time.Second))
+
+			// keep active
+			for i := 0; i < 3; i++ {
+				assert.NoError(t, client.Write("hello", WriteOptions{Flush: true}))
+				_, err := client.Read(ReadOptions{Timeout: time.Second})
+				assert.NoError(t, err)
+				time.Sleep(time.Millisecond * 50)
+			}
+
+			start := time.Now()
+			_, err := client.Read(ReadOptions{Timeout: time.Second * 5})
+			assert.Error(t, err)
+			assert.True(t, time.Since(start) < time.Second*2)
+		})
+	}
+}
+
+func TestIdleAware(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	aware := &testIdleAware[string, string]{}
+	app := newTestApp(t,
+		[]string{testUnixSocket},
+		nil,
+		WithAppIdleTimeout[string, string](time.Millisecond*50, 0, time.Millisecond*50),
+		WithAppSessionIdleAware[string, string](aware))
+	assert.NoError(t, app.Start())
+	defer app.Stop()
+
+	client := newTestIOSession(t)
+	defer client.Close()
+	assert.NoError(t, client.Connect(testUnixSocket, time.Second))
+
+	time.Sleep(time.Millisecond * 300)
+	assert.True(t, client.Connected())
+	states := aware.getStates()
+	assert.Contains(t, states, ReaderIdle)
+	assert.Contains(t, states, AllIdle)
+	assert.NotContains(t, states, WriterIdle)
+	// fired once per timeout period
+	assert.True(t, len(states) <= 12)
+}
+
+type testIdleAware[IN any, OUT any] struct {
+	sync.Mutex
+	states []IdleState
+}
+
+func (ta *testIdleAware[IN, OUT]) Idle(rs IOSession[IN, OUT], state IdleState) bool {
+	ta.Lock()
+	defer ta.Unlock()
+	ta.states = append(ta.states, state)
+	return false
+}
+
+func (ta *testIdleAware[IN, OUT]) getStates() []IdleState {
+	ta.Lock()
+	defer ta.Unlock()
+	return append([]IdleState(nil), ta.states...)
+}
@@ -0,0 +1,98 @@
+package goetty
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+)
+
+// IPFilter filters the connections by the allow and deny lists of CIDRs, both IPv4 and IPv6
+// are supported. A plain IP is treated as a single address CIDR. The deny list is checked
+// first, and if the allow list is empty, all IPs not denied are allowed. The lists can be
+// updated at runtime by Update.
+type IPFilter struct {
+	rules atomic.Value // *ipRules
+}
+
+type ipRules struct {
+	allow []netip.Prefix
+	deny  []netip.Prefix
+}
+
+// NewIPFilter returns an IPFilter with the allow and deny lists
+func NewIPFilter(allow, deny []string) (*IPFilter, error) {
+	f := &IPFilter{}
+	if err := f.Update(allow, deny); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Update replaces the allow and deny lists atomically, the lists are not changed if any
+// CIDR is invalid.
+func (f *IPFilter) Update(allow, deny []string) error {
+	allowPrefixes, err := parsePrefixes(allow)
+	if err != nil {
+		return err
+	}
+	denyPrefixes, err := parsePrefixes(deny)
+	if err != nil {
+		return err
+	}
+	f.rules.Store(&ipRules{allow: allowPrefixes, deny: denyPrefixes})
+	return nil
+}
+
+// Allowed returns true if the ip is allowed
+func (f *IPFilter) Allowed(ip netip.Addr) bool {
+	rules := f.rules.Load().(*ipRules)
+	ip = ip.Unmap()
+	for _, prefix := range rules.deny {
+		if prefix.Contains(ip) {
+			return false
+		}
+	}
+	if len(rules.allow) == 0 {
+		return true
+	}
+	for _, prefix := range rules.allow {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowConn returns true if the remote address of the conn is allowed, the conn without
+// an IP address, e.g. unix socket, is always allowed.
+func (f *IPFilter) allowConn(conn net.Conn) bool {
+	addr, ok := conn.RemoteAddr().(*net.TCPAddr)
+	if !ok {
+		return true
+	}
+	return f.Allowed(addr.AddrPort().Addr())
+}
+
+func parsePrefixes(values []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, value := range values {
+		if !strings.Contains(value, "/") {
+			ip, err := netip.ParseAddr(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid ip %q: %w", value, err)
+			}
+			ip = ip.Unmap()
+			prefixes = append(prefixes, netip.PrefixFrom(ip, ip.BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cidr %q: %w", value, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
@@ -0,0 +1,85 @@
+package goetty
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/lni/goutils/leaktest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIPFilterAllowed(t *testing.T) {
+	cases := []struct {
+		allow   []string
+		deny    []string
+		ip      string
+		allowed bool
+	}{
+		{ip: "10.0.0.1", allowed: true},
+		{allow: []string{"10.0.0.0/8"}, ip: "10.1.2.3", allowed: true},
+		{allow: []string{"10.0.0.0/8"}, ip: "192.168.0.1", allowed: false},
+		{allow: []string{"10.0.0.0/8"}, deny: []string{"10.1.0.0/16"}, ip: "10.1.2.3", allowed: false},
+		{deny: []string{"10.1.2.3"}, ip: "10.1.2.3", allowed: false},
+		{deny: []string{"10.1.2.3"}, ip: "10.1.2.4", allowed: true},
+		{allow: []string{"10.0.0.0/8"}, ip: "::ffff:10.1.2.3", allowed: true},
+		{allow: []string{"2001:db8::/32"}, ip: "2001:db8::1", allowed: true},
+		{allow: []string{"2001:db8::/32"}, ip: "2001:db9::1", allowed: false},
+		{deny: []string{"::1"}, ip: "::1", allowed: false},
+	}
+
+	for i, c := range cases {
+		f, err := NewIPFilter(c.allow, c.deny)
+		assert.NoError(t, err, "case %d", i)
+		assert.Equal(t, c.allowed, f.Allowed(netip.MustParseAddr(c.ip)), "case %d", i)
+	}
+}
+
+func TestIPFilterUpdate(t *testing.T) {
+	f, err := NewIPFilter(nil, []string{"10.0.0.0/8"})
+	assert.NoError(t, err)
+	assert.False(t, f.Allowed(netip.MustParseAddr("10.0.0.1")))
+
+	_, err = NewIPFilter([]string{"10.0.0.0/33"}, nil)
+	assert.Error(t, err)
+	assert.Error(t, f.Update(nil, []string{"invalid"}))
+	assert.False(t, f.Allowed(netip.MustParseAddr("10.0.0.1")))
+
+	assert.NoError(t, f.Update(nil, nil))
+	assert.True(t, f.Allowed(netip.MustParseAddr("10.0.0.1")))
+}
+
+func TestAppWithIPFilter(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	filter, err := NewIPFilter(nil, []string{"127.0.0.0/8"})
+	assert.NoError(t, err)
+	app := newTestApp(t,
+		testListenAddresses,
+		func(i IOSession[string, string], a string, u uint64) error {
+			return i.Write(a, WriteOptions{Flush: true})
+		},
+		WithAppIPFilter[string, string](filter))
+	assert.NoError(t, app.Start())
+	defer app.Stop()
+
+	s1 := newTestIOSession(t)
+	defer s1.Close()
+	assert.NoError(t, s1.Connect(testAddr, time.Second))
+	_, err = s1.Read(ReadOptions{Timeout: time.Second})
+	assert.Error(t, err)
+	assert.Equal(t, uint64(1), app.RejectedConnections())
+
+	// unix socket bypass the filter
+	s2 := newTestIOSession(t)
+	defer s2.Close()
+	assert.NoError(t, s2.Connect(testUnixSocket, time.Second))
+	assertTestEcho(t, s2)
+
+	assert.NoError(t, filter.Update([]string{"127.0.0.1"}, nil))
+	s3 := newTestIOSession(t)
+	defer s3.Close()
+	assert.NoError(t, s3.Connect(testAddr, time.Second))
+	assertTestEcho(t, s3)
+	assert.Equal(t, uint64(1), app.RejectedConnections())
+}
@@ -0,0 +1,46 @@
+package goetty
+
+import (
+	"net"
+	"sync"
+	"syscall"
+)
+
+// copyBufPools the pools of the io copy buffers used if the dst is not a io.ReaderFrom, e.g.
+// tls.Conn, keyed by the buffer size
+var copyBufPools sync.Map
+
+func acquireCopyBuf(size int) *[]byte {
+	return copyBufPool(size).Get().(*[]byte)
+}
+
+func releaseCopyBuf(size int, v *[]byte) {
+	copyBufPool(size).Put(v)
+}
+
+func copyBufPool(size int) *sync.Pool {
+	if p, ok := copyBufPools.Load(size); ok {
+		return p.(*sync.Pool)
+	}
+	p, _ := copyBufPools.LoadOrStore(size, &sync.Pool{
+		New: func() any {
+			v := make([]byte, size)
+			return &v
+		},
+	})
+	return p.(*sync.Pool)
+}
+
+// syscallRawConn returns the syscall.RawConn of the conn to wait readable, nil if the conn is
+// not a syscall.Conn. The tls.Conn is not supported since the decrypted data may be buffered.
+func syscallRawConn(conn net.Conn) syscall.RawConn {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return nil
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return nil
+	}
+	return raw
+}
@@ -0,0 +1,138 @@
+package goetty
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/lni/goutils/leaktest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLazyBuffers(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	skipLazyBuffersRelease(t)
+
+	app := newTestApp(t,
+		testListenAddresses,
+		func(rs IOSession[string, string], msg string, received uint64) error {
+			return rs.Write(msg, WriteOptions{Flush: true})
+		})
+	assert.NoError(t, app.Start())
+	defer app.Stop()
+
+	for name, address := range testAddresses {
+		addr := address
+		t.Run(name, func(t *testing.T) {
+			rs := newTestIOSession(t, WithSessionLazyBuffers[string, string](time.Millisecond*50))
+			defer rs.Close()
+			assert.NoError(t, rs.Connect(addr, time.Second))
+			stats := rs.(MemoryStatsAware).MemoryStats()
+			assert.Equal(t, 0, stats.Total())
+
+			assertTestEcho(t, rs)
+			stats = rs.(MemoryStatsAware).MemoryStats()
+			assert.True(t, stats.InBuf > 0)
+			assert.True(t, stats.OutBuf > 0)
+
+			// the buffers are released after idle while waiting for the data
+			_, err := rs.Read(ReadOptions{Timeout: time.Millisecond * 200})
+			assert.Error(t, err)
+			assert.True(t, isTimeoutErr(err))
+			assert.Equal(t, SessionMemoryStats{}, rs.(MemoryStatsAware).MemoryStats())
+
+			assertTestEcho(t, rs)
+			assert.True(t, rs.(MemoryStatsAware).MemoryStats().Total() > 0)
+		})
+	}
+}
+
+func TestLazyBuffersReleasedInBackground(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	skipLazyBuffersRelease(t)
+
+	app := newTestApp(t,
+		[]string{testUnixSocket},
+		func(rs IOSession[string, string], msg string, received uint64) error {
+			return rs.Write(msg, WriteOptions{Flush: true})
+		})
+	assert.NoError(t, app.Start())
+	defer app.Stop()
+
+	rs := newTestIOSession(t, WithSessionLazyBuffers[string, string](time.Millisecond*50))
+	defer rs.Close()
+	assert.NoError(t, rs.Connect(testUnixSocket, time.Second))
+	assertTestEcho(t, rs)
+
+	replyC := make(chan string, 1)
+	go func() {
+		reply, err := rs.Read(ReadOptions{})
+		assert.NoError(t, err)
+		replyC <- reply
+	}()
+	assert.Eventually(t, func() bool {
+		return rs.(MemoryStatsAware).MemoryStats().Total() == 0
+	}, time.Second, time.Millisecond*10)
+	assert.NoError(t, rs.Write("world", WriteOptions{Flush: true}))
+	assert.Equal(t, "world", <-replyC)
+}
+
+func TestEagerBuffersMemoryStats(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	app := newTestApp(t, []string{testUnixSocket}, nil)
+	assert.NoError(t, app.Start())
+	defer app.Stop()
+
+	rs := newTestIOSession(t)
+	defer rs.Close()
+	assert.Equal(t, SessionMemoryStats{}, rs.(MemoryStatsAware).MemoryStats())
+	assert.NoError(t, rs.Connect(testUnixSocket, time.Second))
+	assert.Equal(t, SessionMemoryStats{InBuf: defaultReadBuf, OutBuf: defaultWriteBuf},
+		rs.(MemoryStatsAware).MemoryStats())
+}
+
+func TestLazyBuffersWithApp(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	skipLazyBuffersRelease(t)
+
+	for name, opts := range map[string][]AppOption[string, string]{
+		"goroutine":  nil,
+		"event-loop": {WithAppEventLoop[string, string](1)},
+	} {
+		appOpts := opts
+		t.Run(name, func(t *testing.T) {
+			app := newTestApp(t, testListenAddresses,
+				func(rs IOSession[string, string], msg string, received uint64) error {
+					return rs.Write(msg, WriteOptions{Flush: true})
+				},
+				append(appOpts, WithAppSessionOptions(
+					WithSessionLazyBuffers[string, string](time.Millisecond*50)))...)
+			assert.NoError(t, app.Start())
+			defer app.Stop()
+
+			for _, address := range testAddresses {
+				rs := newTestIOSession(t)
+				assert.NoError(t, rs.Connect(address, time.Second))
+				assertTestEcho(t, rs)
+				defer rs.Close()
+			}
+
+			assert.Eventually(t, func() bool {
+				total := 0
+				app.Range(func(rs IOSession[string, string]) bool {
+					stats := rs.(MemoryStatsAware).MemoryStats()
+					total += stats.InBuf + stats.OutBuf
+					return true
+				})
+				return total == 0
+			}, time.Second, time.Millisecond*10)
+		})
+	}
+}
+
+func skipLazyBuffersRelease(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the buffers are not released after idle on windows")
+	}
+}
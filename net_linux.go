@@ -12,3 +12,13 @@ func listenControl(network string, address string, conn syscall.RawConn) (err er
 		syscall.SetsockoptInt(int(fd), syscall.SOL_TCP, unix.TCP_FASTOPEN, 1)
 	})
 }
+
+// waitConnReadable blocks until the conn is readable or the read deadline exceeded, the data
+// is not consumed.
+func waitConnReadable(conn syscall.RawConn) error {
+	var b [1]byte
+	return conn.Read(func(fd uintptr) bool {
+		_, _, err := unix.Recvfrom(int(fd), b[:], unix.MSG_PEEK|unix.MSG_DONTWAIT)
+		return err != unix.EAGAIN
+	})
+}
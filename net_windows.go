@@ -5,3 +5,8 @@ import "syscall"
 func listenControl(network string, address string, conn syscall.RawConn) error {
 	return nil
 }
+
+// waitConnReadable returns immediately, the buffers are not released after idle on windows
+func waitConnReadable(conn syscall.RawConn) error {
+	return nil
+}
@@ -1,5 +1,7 @@
 package goetty
 
+import "time"
+
 const (
 	// defaultSessionBucketSize default bucket size of session map
 	defaultSessionBucketSize = uint64(64)
@@ -7,10 +9,56 @@ const (
 	defaultReadBuf = 256
 	// defaultWriteBuf write buf size
 	defaultWriteBuf = 256
-	// defaultReadCopyBuf io.CopyBuffer buffer size for read
-	defaultReadCopyBuf = 1024 * 64
-	// defaultWriteCopyBuf io.CopyBuffer buffer size for write
+	// defaultWriteCopyBuf io.CopyBuffer buffer size to write the file
 	defaultWriteCopyBuf = 1024 * 64
+	// defaultAsyncWriteQueueSize max number of messages in the async write queue
+	defaultAsyncWriteQueueSize = 1024
+	// defaultAsyncWriteDrainTimeout max time to flush the queued messages before close
+	defaultAsyncWriteDrainTimeout = time.Second * 5
+	// defaultReconnectInitialBackoff backoff before the second reconnect attempt
+	defaultReconnectInitialBackoff = time.Millisecond * 100
+	// defaultReconnectMaxBackoff max backoff between two reconnect attempts
+	defaultReconnectMaxBackoff = time.Second * 30
+	// defaultReconnectMultiplier factor to multiply the reconnect backoff
+	defaultReconnectMultiplier = 2
+	// defaultPoolMaxSize max number of IOSessions per address in the SessionPool
+	defaultPoolMaxSize = 8
+	// defaultPoolConnectTimeout timeout to connect the pooled IOSessions
+	defaultPoolConnectTimeout = time.Second * 10
+	// defaultPoolMaintainInterval max interval to evict and fill the pooled IOSessions
+	defaultPoolMaintainInterval = time.Second
+	// defaultRejectWriteTimeout timeout to write the message to the rejected connection
+	defaultRejectWriteTimeout = time.Second
+	// defaultBroadcastConcurrency max number of sessions written concurrently by Broadcast
+	defaultBroadcastConcurrency = 16
+	// defaultLazyBuffersIdleTimeout idle time to release the buffers of the lazy buffers session
+	defaultLazyBuffersIdleTimeout = time.Minute
+	// defaultWriteFileChunkSize max bytes of the file written at once by FileWriter.WriteFile
+	defaultWriteFileChunkSize = 1024 * 1024 * 4
+	// defaultProxyCopyChunkSize max bytes forwarded at once by the proxy
+	defaultProxyCopyChunkSize = 1024 * 64
+	// defaultHealthCheckInterval interval between two probes of the proxy upstream
+	defaultHealthCheckInterval = time.Second * 5
+	// defaultHealthCheckRise consecutive successful probes to mark an upstream healthy
+	defaultHealthCheckRise = 2
+	// defaultHealthCheckFall consecutive failed probes to mark an upstream unhealthy
+	defaultHealthCheckFall = 3
+	// defaultHealthCheckTimeout timeout of each probe if no timeout is configured
+	defaultHealthCheckTimeout = time.Second * 3
+	// defaultConsistentHashReplicas virtual nodes of each upstream on the consistent hash ring
+	defaultConsistentHashReplicas = 100
+	// defaultCircuitBreakerFailureThreshold consecutive dial failures to open the circuit
+	defaultCircuitBreakerFailureThreshold = 5
+	// defaultCircuitBreakerCoolDown time to keep the circuit open
+	defaultCircuitBreakerCoolDown = time.Second * 10
+	// defaultProxyHeaderTimeout max time to read the PROXY protocol header
+	defaultProxyHeaderTimeout = time.Second * 5
+	// defaultMessageProxyRequestTimeout max time to forward a request by the message proxy
+	defaultMessageProxyRequestTimeout = time.Second * 10
+	// defaultWorkerPoolSize number of the workers to handle the messages
+	defaultWorkerPoolSize = 64
+	// defaultWorkerQueueSize max number of the queued messages of the worker pool
+	defaultWorkerQueueSize = 1024
 )
 
 // IOSessionAware io session aware
@@ -20,3 +68,53 @@ type IOSessionAware[IN any, OUT any] interface {
 	//Closed session closed
 	Closed(IOSession[IN, OUT])
 }
+
+// ChainSessionAware returns an IOSessionAware which notifies the awares in order
+func ChainSessionAware[IN any, OUT any](awares ...IOSessionAware[IN, OUT]) IOSessionAware[IN, OUT] {
+	return chainedSessionAware[IN, OUT](awares)
+}
+
+type chainedSessionAware[IN any, OUT any] []IOSessionAware[IN, OUT]
+
+func (c chainedSessionAware[IN, OUT]) Created(rs IOSession[IN, OUT]) {
+	for _, aware := range c {
+		aware.Created(rs)
+	}
+}
+
+func (c chainedSessionAware[IN, OUT]) Closed(rs IOSession[IN, OUT]) {
+	for _, aware := range c {
+		aware.Closed(rs)
+	}
+}
+
+// IdleState idle state of IOSession
+type IdleState int
+
+const (
+	// ReaderIdle no data was read from the IOSession for a while
+	ReaderIdle IdleState = iota
+	// WriterIdle no data was written to the IOSession for a while
+	WriterIdle
+	// AllIdle no data was read or written for a while
+	AllIdle
+)
+
+// String returns the name of the idle state
+func (s IdleState) String() string {
+	switch s {
+	case ReaderIdle:
+		return "reader-idle"
+	case WriterIdle:
+		return "writer-idle"
+	case AllIdle:
+		return "all-idle"
+	}
+	return "unknown"
+}
+
+// IOSessionIdleAware io session idle aware
+type IOSessionIdleAware[IN any, OUT any] interface {
+	// Idle session is idle, returns true to close the session
+	Idle(IOSession[IN, OUT], IdleState) bool
+}
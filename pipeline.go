@@ -0,0 +1,73 @@
+package goetty
+
+// InboundHandler handles a message received by the session, it has the same signature as the
+// handleFunc of NetApplication.
+type InboundHandler[IN any, OUT any] func(rs IOSession[IN, OUT], msg IN, received uint64) error
+
+// InboundInterceptor intercepts the messages received by the session before they are handled
+// by the handleFunc of NetApplication. It can pass the message, or a modified one, to the next
+// handler by calling next, or short-circuit the pipeline by not calling next. Returning an
+// error closes the session.
+type InboundInterceptor[IN any, OUT any] func(rs IOSession[IN, OUT], msg IN, received uint64, next InboundHandler[IN, OUT]) error
+
+// OutboundHandler handles a message written by IOSession.Write
+type OutboundHandler[IN any, OUT any] func(rs IOSession[IN, OUT], msg OUT, options WriteOptions) error
+
+// OutboundInterceptor intercepts the messages written by IOSession.Write before they are
+// encoded. It can pass the message, or a modified one, to the next handler by calling next,
+// or short-circuit the pipeline by not calling next. The returned error is returned by Write.
+type OutboundInterceptor[IN any, OUT any] func(rs IOSession[IN, OUT], msg OUT, options WriteOptions, next OutboundHandler[IN, OUT]) error
+
+// ChainInboundInterceptors returns an InboundHandler which calls the interceptors in order,
+// and the handler at last.
+func ChainInboundInterceptors[IN any, OUT any](handler InboundHandler[IN, OUT], interceptors ...InboundInterceptor[IN, OUT]) InboundHandler[IN, OUT] {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], handler
+		handler = func(rs IOSession[IN, OUT], msg IN, received uint64) error {
+			return interceptor(rs, msg, received, next)
+		}
+	}
+	return handler
+}
+
+// ChainOutboundInterceptors returns an OutboundHandler which calls the interceptors in order,
+// and the handler at last.
+func ChainOutboundInterceptors[IN any, OUT any](handler OutboundHandler[IN, OUT], interceptors ...OutboundInterceptor[IN, OUT]) OutboundHandler[IN, OUT] {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], handler
+		handler = func(rs IOSession[IN, OUT], msg OUT, options WriteOptions) error {
+			return interceptor(rs, msg, options, next)
+		}
+	}
+	return handler
+}
+
+// inboundInterceptorsHolder is implemented by the IOSession which has the session level
+// inbound interceptors
+type inboundInterceptorsHolder[IN any, OUT any] interface {
+	inboundInterceptors() []InboundInterceptor[IN, OUT]
+}
+
+func (bio *baseIO[IN, OUT]) inboundInterceptors() []InboundInterceptor[IN, OUT] {
+	return bio.options.inboundInterceptors
+}
+
+// addInterceptors adds the interceptors after the IOSession created, must be called before the
+// IOSession is used
+func (bio *baseIO[IN, OUT]) addInterceptors(inbound []InboundInterceptor[IN, OUT], outbound []OutboundInterceptor[IN, OUT]) {
+	bio.options.inboundInterceptors = append(bio.options.inboundInterceptors, inbound...)
+	if len(outbound) > 0 {
+		bio.options.outboundInterceptors = append(bio.options.outboundInterceptors, outbound...)
+		bio.resetOutbound()
+	}
+}
+
+// resetOutbound chains the outbound interceptors of the IOSession
+func (bio *baseIO[IN, OUT]) resetOutbound() {
+	bio.outbound = nil
+	if len(bio.options.outboundInterceptors) > 0 {
+		bio.outbound = ChainOutboundInterceptors(func(_ IOSession[IN, OUT], msg OUT, options WriteOptions) error {
+			return bio.doWrite(msg, options)
+		}, bio.options.outboundInterceptors...)
+	}
+}
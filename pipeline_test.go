@@ -0,0 +1,144 @@
+package goetty
+
+import (
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lni/goutils/leaktest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChainInboundInterceptors(t *testing.T) {
+	var calls []string
+	newInterceptor := func(name string) InboundInterceptor[string, string] {
+		return func(rs IOSession[string, string], msg string, received uint64, next InboundHandler[string, string]) error {
+			calls = append(calls, name)
+			if msg == name {
+				return nil
+			}
+			return next(rs, msg+"-"+name, received)
+		}
+	}
+	handler := ChainInboundInterceptors(func(rs IOSession[string, string], msg string, received uint64) error {
+		calls = append(calls, msg)
+		return nil
+	}, newInterceptor("a"), newInterceptor("b"))
+
+	assert.NoError(t, handler(nil, "hello", 1))
+	assert.Equal(t, []string{"a", "b", "hello-a-b"}, calls)
+
+	calls = calls[:0]
+	assert.NoError(t, handler(nil, "a", 1))
+	assert.Equal(t, []string{"a"}, calls)
+}
+
+func TestChainOutboundInterceptors(t *testing.T) {
+	var written string
+	handler := ChainOutboundInterceptors(func(rs IOSession[string, string], msg string, options WriteOptions) error {
+		written = msg
+		return nil
+	})
+	assert.NoError(t, handler(nil, "hello", WriteOptions{}))
+	assert.Equal(t, "hello", written)
+}
+
+func TestAppWithInterceptors(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	errClose := errors.New("close")
+	auth := func(rs IOSession[string, string], msg string, received uint64, next InboundHandler[string, string]) error {
+		switch {
+		case msg == "close":
+			return errClose
+		case received == 1 && msg != "auth":
+			return rs.Write("denied", WriteOptions{Flush: true})
+		}
+		return next(rs, msg, received)
+	}
+	upper := func(rs IOSession[string, string], msg string, received uint64, next InboundHandler[string, string]) error {
+		return next(rs, strings.ToUpper(msg), received)
+	}
+	newOutbound := func(name string) OutboundInterceptor[string, string] {
+		return func(rs IOSession[string, string], msg string, options WriteOptions, next OutboundHandler[string, string]) error {
+			return next(rs, msg+"-"+name, options)
+		}
+	}
+
+	app := newTestApp(t, testListenAddresses,
+		func(rs IOSession[string, string], msg string, received uint64) error {
+			return rs.Write(msg, WriteOptions{Flush: true})
+		},
+		WithAppInboundInterceptors(auth),
+		WithAppOutboundInterceptors(newOutbound("app")),
+		WithAppSessionOptions(
+			WithSessionInboundInterceptors(upper),
+			WithSessionOutboundInterceptors(newOutbound("session"))))
+	assert.NoError(t, app.Start())
+	defer app.Stop()
+
+	for name, address := range testAddresses {
+		addr := address
+		t.Run(name, func(t *testing.T) {
+			rs := newTestIOSession(t)
+			defer rs.Close()
+			assert.NoError(t, rs.Connect(addr, time.Second))
+
+			assert.NoError(t, rs.Write("hello", WriteOptions{Flush: true}))
+			reply, err := rs.Read(ReadOptions{Timeout: time.Second})
+			assert.NoError(t, err)
+			assert.Equal(t, "denied-session-app", reply)
+
+			assert.NoError(t, rs.Write("hello", WriteOptions{Flush: true}))
+			reply, err = rs.Read(ReadOptions{Timeout: time.Second})
+			assert.NoError(t, err)
+			assert.Equal(t, "HELLO-session-app", reply)
+
+			assert.NoError(t, rs.Write("close", WriteOptions{Flush: true}))
+			_, err = rs.Read(ReadOptions{Timeout: time.Second})
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestAppWithSessionInterceptors(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	var created int32
+	upper := func(rs IOSession[string, string], msg string, received uint64, next InboundHandler[string, string]) error {
+		return next(rs, strings.ToUpper(msg), received)
+	}
+	newOutbound := func(name string) OutboundInterceptor[string, string] {
+		return func(rs IOSession[string, string], msg string, options WriteOptions, next OutboundHandler[string, string]) error {
+			return next(rs, msg+"-"+name, options)
+		}
+	}
+	app := newTestApp(t, []string{testAddr},
+		func(rs IOSession[string, string], msg string, received uint64) error {
+			return rs.Write(msg, WriteOptions{Flush: true})
+		},
+		WithAppOutboundInterceptors(newOutbound("app")),
+		WithAppSessionInterceptors(func(rs IOSession[string, string]) ([]InboundInterceptor[string, string], []OutboundInterceptor[string, string]) {
+			assert.NotEmpty(t, rs.RemoteAddress())
+			// only the first session converts the messages to upper case
+			if atomic.AddInt32(&created, 1) == 1 {
+				return []InboundInterceptor[string, string]{upper},
+					[]OutboundInterceptor[string, string]{newOutbound("s1")}
+			}
+			return nil, []OutboundInterceptor[string, string]{newOutbound("s2")}
+		}))
+	assert.NoError(t, app.Start())
+	defer app.Stop()
+
+	for _, expect := range []string{"HELLO-s1-app", "hello-s2-app"} {
+		rs := newTestIOSession(t)
+		assert.NoError(t, rs.Connect(testAddr, time.Second))
+		assert.NoError(t, rs.Write("hello", WriteOptions{Flush: true}))
+		reply, err := rs.Read(ReadOptions{Timeout: time.Second})
+		assert.NoError(t, err)
+		assert.Equal(t, expect, reply)
+		assert.NoError(t, rs.Close())
+	}
+}
@@ -0,0 +1,459 @@
+package goetty
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrPoolClosed the session pool is closed
+	ErrPoolClosed = errors.New("session pool closed")
+	// ErrPoolExhausted all the IOSessions of the address are borrowed, and none is returned
+	// before the ctx done
+	ErrPoolExhausted = errors.New("session pool exhausted")
+)
+
+// poolExhaustedError is returned by Get if failed to borrow an IOSession, it matches both
+// ErrPoolExhausted and the error of the ctx.
+type poolExhaustedError struct {
+	address string
+	err     error
+}
+
+func (e *poolExhaustedError) Error() string {
+	return fmt.Sprintf("borrow session of %s failed: %s: %s", e.address, ErrPoolExhausted, e.err)
+}
+
+func (e *poolExhaustedError) Is(target error) bool {
+	return target == ErrPoolExhausted
+}
+
+func (e *poolExhaustedError) Unwrap() error {
+	return e.err
+}
+
+// PoolOption option to create SessionPool
+type PoolOption[IN any, OUT any] func(*sessionPool[IN, OUT])
+
+// WithPoolLogger set logger for SessionPool
+func WithPoolLogger[IN any, OUT any](logger *zap.Logger) PoolOption[IN, OUT] {
+	return func(p *sessionPool[IN, OUT]) {
+		p.logger = logger
+	}
+}
+
+// WithPoolSessionOptions set options to create the pooled IOSessions, e.g. codec, tls and
+// allocator.
+func WithPoolSessionOptions[IN any, OUT any](options ...Option[IN, OUT]) PoolOption[IN, OUT] {
+	return func(p *sessionPool[IN, OUT]) {
+		p.options.sessionOpts = options
+	}
+}
+
+// WithPoolSize set the min and max number of IOSessions per address. The pool keeps at
+// least min IOSessions once the address is used, and Get blocks if max IOSessions are
+// borrowed.
+func WithPoolSize[IN any, OUT any](min, max int) PoolOption[IN, OUT] {
+	return func(p *sessionPool[IN, OUT]) {
+		p.options.minSize = min
+		p.options.maxSize = max
+	}
+}
+
+// WithPoolIdleTimeout set the idle timeout, the IOSessions which are not used for the
+// timeout are closed, unless the pool has only min IOSessions. 0 means never.
+func WithPoolIdleTimeout[IN any, OUT any](value time.Duration) PoolOption[IN, OUT] {
+	return func(p *sessionPool[IN, OUT]) {
+		p.options.idleTimeout = value
+	}
+}
+
+// WithPoolBorrowTimeout set the max time to wait for an IOSession if the context passed to
+// Get has no deadline.
+func WithPoolBorrowTimeout[IN any, OUT any](value time.Duration) PoolOption[IN, OUT] {
+	return func(p *sessionPool[IN, OUT]) {
+		p.options.borrowTimeout = value
+	}
+}
+
+// WithPoolConnectTimeout set the timeout to connect the new IOSessions
+func WithPoolConnectTimeout[IN any, OUT any](value time.Duration) PoolOption[IN, OUT] {
+	return func(p *sessionPool[IN, OUT]) {
+		p.options.connectTimeout = value
+	}
+}
+
+// WithPoolValidator set a func to validate the idle IOSession before it borrowed, the
+// IOSession will be closed if the func returns false.
+func WithPoolValidator[IN any, OUT any](value func(IOSession[IN, OUT]) bool) PoolOption[IN, OUT] {
+	return func(p *sessionPool[IN, OUT]) {
+		p.options.validator = value
+	}
+}
+
+// SessionPool manages the client IOSessions to multiple remote addresses
+type SessionPool[IN any, OUT any] interface {
+	// Get borrows a connected IOSession of the address from the pool. The IOSession returns
+	// back to the pool when it is closed, and it will be discarded if it is disconnected. The
+	// deadline of the ctx also limits the time to connect a new IOSession. Returns an error
+	// matches ErrPoolExhausted if no IOSession can be borrowed before the ctx done.
+	// If the IOSession is held by several goroutines, use Ref and Close in pairs, it returns
+	// back to the pool once the reference count reaches 0.
+	Get(ctx context.Context, address string) (IOSession[IN, OUT], error)
+	// Close close the pool and all idle IOSessions, the borrowed IOSessions will be closed
+	// once they return back.
+	Close() error
+}
+
+type sessionPool[IN any, OUT any] struct {
+	logger *zap.Logger
+	stopC  chan struct{}
+	doneC  chan struct{}
+
+	mu struct {
+		sync.Mutex
+		closed bool
+		pools  map[string]*addressPool[IN, OUT]
+	}
+
+	options struct {
+		sessionOpts    []Option[IN, OUT]
+		minSize        int
+		maxSize        int
+		idleTimeout    time.Duration
+		borrowTimeout  time.Duration
+		connectTimeout time.Duration
+		validator      func(IOSession[IN, OUT]) bool
+	}
+}
+
+// NewSessionPool returns a SessionPool
+func NewSessionPool[IN any, OUT any](opts ...PoolOption[IN, OUT]) SessionPool[IN, OUT] {
+	p := &sessionPool[IN, OUT]{}
+	for _, opt := range opts {
+		opt(p)
+	}
+	p.adjust()
+	p.mu.pools = make(map[string]*addressPool[IN, OUT])
+
+	if p.options.minSize > 0 || p.options.idleTimeout > 0 {
+		p.stopC = make(chan struct{})
+		p.doneC = make(chan struct{})
+		go p.maintain()
+	}
+	return p
+}
+
+func (p *sessionPool[IN, OUT]) adjust() {
+	p.logger = adjustLogger(p.logger).Named("session-pool")
+	if p.options.maxSize <= 0 {
+		p.options.maxSize = defaultPoolMaxSize
+	}
+	if p.options.minSize > p.options.maxSize {
+		p.options.minSize = p.options.maxSize
+	}
+	if p.options.connectTimeout <= 0 {
+		p.options.connectTimeout = defaultPoolConnectTimeout
+	}
+	if p.options.validator == nil {
+		p.options.validator = func(IOSession[IN, OUT]) bool { return true }
+	}
+}
+
+func (p *sessionPool[IN, OUT]) Get(ctx context.Context, address string) (IOSession[IN, OUT], error) {
+	ap, err := p.getAddressPool(address)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := ctx.Deadline(); !ok && p.options.borrowTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.options.borrowTimeout)
+		defer cancel()
+	}
+	return ap.get(ctx)
+}
+
+func (p *sessionPool[IN, OUT]) Close() error {
+	p.mu.Lock()
+	if p.mu.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.mu.closed = true
+	pools := p.mu.pools
+	p.mu.Unlock()
+
+	if p.stopC != nil {
+		close(p.stopC)
+		<-p.doneC
+	}
+	for _, ap := range pools {
+		ap.close()
+	}
+	return nil
+}
+
+func (p *sessionPool[IN, OUT]) getAddressPool(address string) (*addressPool[IN, OUT], error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.mu.closed {
+		return nil, ErrPoolClosed
+	}
+	ap, ok := p.mu.pools[address]
+	if !ok {
+		ap = newAddressPool(p, address)
+		p.mu.pools[address] = ap
+	}
+	return ap, nil
+}
+
+func (p *sessionPool[IN, OUT]) maintain() {
+	defer close(p.doneC)
+
+	interval := p.options.idleTimeout / 2
+	if interval <= 0 || interval > defaultPoolMaintainInterval {
+		interval = defaultPoolMaintainInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stopC:
+			return
+		case now := <-ticker.C:
+			p.mu.Lock()
+			pools := make([]*addressPool[IN, OUT], 0, len(p.mu.pools))
+			for _, ap := range p.mu.pools {
+				pools = append(pools, ap)
+			}
+			p.mu.Unlock()
+
+			for _, ap := range pools {
+				ap.evict(now)
+				ap.fill()
+			}
+		}
+	}
+}
+
+// addressPool holds the IOSessions of an address. A token is required to borrow an
+// IOSession, so at most maxSize IOSessions can be borrowed, and a new IOSession is created
+// only if there is no idle IOSessions, so the total IOSessions never exceeds maxSize.
+type addressPool[IN any, OUT any] struct {
+	p       *sessionPool[IN, OUT]
+	logger  *zap.Logger
+	address string
+	tokens  chan struct{}
+
+	mu struct {
+		sync.Mutex
+		closed bool
+		total  int
+		// idle the idle IOSessions, the last one is the most recently used
+		idle []*pooledSession[IN, OUT]
+	}
+}
+
+func newAddressPool[IN any, OUT any](p *sessionPool[IN, OUT], address string) *addressPool[IN, OUT] {
+	return &addressPool[IN, OUT]{
+		p:       p,
+		logger:  p.logger.With(zap.String("address", address)),
+		address: address,
+		tokens:  make(chan struct{}, p.options.maxSize),
+	}
+}
+
+func (ap *addressPool[IN, OUT]) get(ctx context.Context) (IOSession[IN, OUT], error) {
+	select {
+	case ap.tokens <- struct{}{}:
+	case <-ctx.Done():
+		return nil, &poolExhaustedError{address: ap.address, err: ctx.Err()}
+	}
+
+	for {
+		ap.mu.Lock()
+		if ap.mu.closed {
+			ap.mu.Unlock()
+			<-ap.tokens
+			return nil, ErrPoolClosed
+		}
+		n := len(ap.mu.idle)
+		if n == 0 {
+			ap.mu.total++
+			ap.mu.Unlock()
+			break
+		}
+		ps := ap.mu.idle[n-1]
+		ap.mu.idle[n-1] = nil
+		ap.mu.idle = ap.mu.idle[:n-1]
+		ap.mu.Unlock()
+
+		if ps.IOSession.Connected() && ap.p.options.validator(ps.IOSession) {
+			atomic.StoreInt32(&ps.ref, 1)
+			return ps, nil
+		}
+		ap.discard(ps)
+	}
+
+	ps, err := ap.create(ctx)
+	if err != nil {
+		ap.mu.Lock()
+		ap.mu.total--
+		ap.mu.Unlock()
+		<-ap.tokens
+		return nil, err
+	}
+	atomic.StoreInt32(&ps.ref, 1)
+	return ps, nil
+}
+
+func (ap *addressPool[IN, OUT]) put(ps *pooledSession[IN, OUT]) {
+	defer func() {
+		<-ap.tokens
+	}()
+
+	ap.mu.Lock()
+	if !ap.mu.closed && ps.IOSession.Connected() {
+		ps.lastUsed = time.Now()
+		ap.mu.idle = append(ap.mu.idle, ps)
+		ap.mu.Unlock()
+		return
+	}
+	ap.mu.Unlock()
+	ap.discard(ps)
+}
+
+// create connects a new IOSession, the connect timeout is limited by the deadline of the ctx
+func (ap *addressPool[IN, OUT]) create(ctx context.Context) (*pooledSession[IN, OUT], error) {
+	timeout := ap.p.options.connectTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return nil, fmt.Errorf("connect session of %s failed: %w", ap.address, context.DeadlineExceeded)
+		}
+		if timeout <= 0 || timeout > remaining {
+			timeout = remaining
+		}
+	}
+
+	rs := NewIOSession(ap.p.options.sessionOpts...)
+	if err := rs.Connect(ap.address, timeout); err != nil {
+		if err := rs.Close(); err != nil {
+			ap.logger.Error("close session failed", zap.Error(err))
+		}
+		return nil, err
+	}
+	return &pooledSession[IN, OUT]{IOSession: rs, pool: ap}, nil
+}
+
+// discard closes the IOSession which is removed from the pool
+func (ap *addressPool[IN, OUT]) discard(ps *pooledSession[IN, OUT]) {
+	ap.mu.Lock()
+	ap.mu.total--
+	ap.mu.Unlock()
+	if err := ps.IOSession.Close(); err != nil {
+		ap.logger.Error("close session failed", zap.Error(err))
+	}
+}
+
+// evict closes the idle IOSessions which are not used in idle timeout
+func (ap *addressPool[IN, OUT]) evict(now time.Time) {
+	if ap.p.options.idleTimeout <= 0 {
+		return
+	}
+
+	ap.mu.Lock()
+	n := 0
+	for n < len(ap.mu.idle) &&
+		ap.mu.total-n > ap.p.options.minSize &&
+		now.Sub(ap.mu.idle[n].lastUsed) >= ap.p.options.idleTimeout {
+		n++
+	}
+	evicted := append([]*pooledSession[IN, OUT](nil), ap.mu.idle[:n]...)
+	ap.mu.idle = append(ap.mu.idle[:0], ap.mu.idle[n:]...)
+	ap.mu.Unlock()
+
+	for _, ps := range evicted {
+		ap.discard(ps)
+	}
+	if len(evicted) > 0 {
+		ap.logger.Debug("idle sessions evicted",
+			zap.Int("count", len(evicted)))
+	}
+}
+
+// fill creates IOSessions until there are min IOSessions in the pool
+func (ap *addressPool[IN, OUT]) fill() {
+	for {
+		ap.mu.Lock()
+		if ap.mu.closed || ap.mu.total >= ap.p.options.minSize {
+			ap.mu.Unlock()
+			return
+		}
+		ap.mu.total++
+		ap.mu.Unlock()
+
+		ps, err := ap.create(context.Background())
+		if err != nil {
+			ap.mu.Lock()
+			ap.mu.total--
+			ap.mu.Unlock()
+			ap.logger.Error("create session failed", zap.Error(err))
+			return
+		}
+
+		ap.mu.Lock()
+		ps.lastUsed = time.Now()
+		ap.mu.idle = append(ap.mu.idle, ps)
+		ap.mu.Unlock()
+	}
+}
+
+func (ap *addressPool[IN, OUT]) close() {
+	ap.mu.Lock()
+	ap.mu.closed = true
+	idle := ap.mu.idle
+	ap.mu.idle = nil
+	ap.mu.Unlock()
+
+	for _, ps := range idle {
+		ap.discard(ps)
+	}
+}
+
+// pooledSession is the IOSession borrowed from the SessionPool, the IOSession returns back
+// to the pool once the reference count reaches 0.
+type pooledSession[IN any, OUT any] struct {
+	IOSession[IN, OUT]
+	pool     *addressPool[IN, OUT]
+	ref      int32
+	lastUsed time.Time
+}
+
+func (ps *pooledSession[IN, OUT]) Ref() {
+	atomic.AddInt32(&ps.ref, 1)
+}
+
+func (ps *pooledSession[IN, OUT]) Close() error {
+	ref := atomic.AddInt32(&ps.ref, -1)
+	if ref < 0 {
+		panic("invalid ref count")
+	}
+	if ref == 0 {
+		ps.pool.put(ps)
+	}
+	return nil
+}
+
+func (ps *pooledSession[IN, OUT]) BufferedConn() net.Conn {
+	return ps.IOSession.(BufferedIOSession).BufferedConn()
+}
@@ -0,0 +1,200 @@
+package goetty
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/fagongzi/goetty/v3/codec/simple"
+	"github.com/lni/goutils/leaktest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessionPoolGetAndReturn(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	app := newTestApp(t,
+		testListenAddresses,
+		func(rs IOSession[string, string], msg string, received uint64) error {
+			return rs.Write(msg, WriteOptions{Flush: true})
+		})
+	assert.NoError(t, app.Start())
+	defer app.Stop()
+
+	pool := newTestSessionPool()
+	defer pool.Close()
+
+	for name, address := range testAddresses {
+		addr := address
+		t.Run(name, func(t *testing.T) {
+			s1, err := pool.Get(context.Background(), addr)
+			assert.NoError(t, err)
+			assert.NoError(t, s1.Write("hello", WriteOptions{Flush: true}))
+			reply, err := s1.Read(ReadOptions{Timeout: time.Second})
+			assert.NoError(t, err)
+			assert.Equal(t, "hello", reply)
+
+			raw := s1.(*pooledSession[string, string]).IOSession
+			s1.Ref()
+			assert.NoError(t, s1.Close())
+			assert.Equal(t, 0, getTestIdleSessions(pool, addr))
+			assert.NoError(t, s1.Close())
+			assert.Equal(t, 1, getTestIdleSessions(pool, addr))
+
+			s2, err := pool.Get(context.Background(), addr)
+			assert.NoError(t, err)
+			assert.Equal(t, raw, s2.(*pooledSession[string, string]).IOSession)
+
+			// disconnected session is discarded
+			assert.NoError(t, s2.Disconnect())
+			assert.NoError(t, s2.Close())
+			assert.Equal(t, 0, getTestIdleSessions(pool, addr))
+
+			s3, err := pool.Get(context.Background(), addr)
+			assert.NoError(t, err)
+			assert.NotEqual(t, raw, s3.(*pooledSession[string, string]).IOSession)
+			assert.NoError(t, s3.Close())
+		})
+	}
+}
+
+func TestSessionPoolMaxSize(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	app := newTestApp(t, []string{testUnixSocket}, nil)
+	assert.NoError(t, app.Start())
+	defer app.Stop()
+
+	pool := newTestSessionPool(WithPoolSize[string, string](0, 1),
+		WithPoolBorrowTimeout[string, string](time.Millisecond*50))
+	defer pool.Close()
+
+	s1, err := pool.Get(context.Background(), testUnixSocket)
+	assert.NoError(t, err)
+
+	_, err = pool.Get(context.Background(), testUnixSocket)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.ErrorIs(t, err, ErrPoolExhausted)
+
+	time.AfterFunc(time.Millisecond*20, func() {
+		assert.NoError(t, s1.Close())
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	s2, err := pool.Get(ctx, testUnixSocket)
+	assert.NoError(t, err)
+	assert.NoError(t, s2.Close())
+}
+
+func TestSessionPoolValidator(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	app := newTestApp(t, []string{testUnixSocket}, nil)
+	assert.NoError(t, app.Start())
+	defer app.Stop()
+
+	pool := newTestSessionPool(WithPoolValidator(func(IOSession[string, string]) bool {
+		return false
+	}))
+	defer pool.Close()
+
+	s1, err := pool.Get(context.Background(), testUnixSocket)
+	assert.NoError(t, err)
+	raw := s1.(*pooledSession[string, string]).IOSession
+	assert.NoError(t, s1.Close())
+
+	s2, err := pool.Get(context.Background(), testUnixSocket)
+	assert.NoError(t, err)
+	assert.NotEqual(t, raw, s2.(*pooledSession[string, string]).IOSession)
+	assert.False(t, raw.Connected())
+	assert.NoError(t, s2.Close())
+}
+
+func TestSessionPoolIdleEviction(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	app := newTestApp(t, []string{testUnixSocket}, nil)
+	assert.NoError(t, app.Start())
+	defer app.Stop()
+
+	pool := newTestSessionPool(WithPoolSize[string, string](1, 4),
+		WithPoolIdleTimeout[string, string](time.Millisecond*20))
+	defer pool.Close()
+
+	var sessions []IOSession[string, string]
+	for i := 0; i < 3; i++ {
+		s, err := pool.Get(context.Background(), testUnixSocket)
+		assert.NoError(t, err)
+		sessions = append(sessions, s)
+	}
+	for _, s := range sessions {
+		assert.NoError(t, s.Close())
+	}
+	assert.Equal(t, 3, getTestIdleSessions(pool, testUnixSocket))
+
+	time.Sleep(time.Millisecond * 100)
+	assert.Equal(t, 1, getTestIdleSessions(pool, testUnixSocket))
+}
+
+func TestSessionPoolClosed(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	app := newTestApp(t, []string{testUnixSocket}, nil)
+	assert.NoError(t, app.Start())
+	defer app.Stop()
+
+	pool := newTestSessionPool()
+	s1, err := pool.Get(context.Background(), testUnixSocket)
+	assert.NoError(t, err)
+	assert.NoError(t, pool.Close())
+
+	_, err = pool.Get(context.Background(), testUnixSocket)
+	assert.Equal(t, ErrPoolClosed, err)
+
+	raw := s1.(*pooledSession[string, string]).IOSession
+	assert.NoError(t, s1.Close())
+	assert.False(t, raw.Connected())
+}
+
+func TestSessionPoolConnectTimeoutLimitedByContext(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	timeoutC := make(chan time.Duration, 1)
+	dial := func(bio *baseIO[string, string]) {
+		bio.options.dial = func(network, address string, timeout time.Duration) (net.Conn, error) {
+			timeoutC <- timeout
+			return nil, errors.New("dial failed")
+		}
+	}
+	pool := NewSessionPool(
+		WithPoolSessionOptions(WithSessionCodec(simple.NewStringCodec()), dial),
+		WithPoolConnectTimeout[string, string](time.Second*10))
+	defer pool.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	_, err := pool.Get(ctx, testUnixSocket)
+	assert.Error(t, err)
+	timeout := <-timeoutC
+	assert.True(t, timeout > 0 && timeout <= time.Millisecond*100)
+
+	_, err = pool.Get(context.Background(), testUnixSocket)
+	assert.Error(t, err)
+	assert.Equal(t, time.Second*10, <-timeoutC)
+}
+
+func newTestSessionPool(opts ...PoolOption[string, string]) SessionPool[string, string] {
+	opts = append([]PoolOption[string, string]{
+		WithPoolSessionOptions(WithSessionCodec(simple.NewStringCodec())),
+	}, opts...)
+	return NewSessionPool(opts...)
+}
+
+func getTestIdleSessions(pool SessionPool[string, string], address string) int {
+	ap, _ := pool.(*sessionPool[string, string]).getAddressPool(address)
+	ap.mu.Lock()
+	defer ap.mu.Unlock()
+	return len(ap.mu.idle)
+}
@@ -1,11 +1,16 @@
 package goetty
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"io"
+	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/fagongzi/goetty/v3/buf"
 	"go.uber.org/zap"
 )
 
@@ -15,77 +20,465 @@ type Proxy interface {
 	Start() error
 	// Stop stop the proxy
 	Stop() error
-	// AddUpStream add upstream
-	AddUpStream(address string, connectTimeout time.Duration)
+	// AddUpStream add upstream, the config of the upstream is updated if the address is
+	// already added. If the upstream is draining, it is replaced by a new upstream, and the
+	// drain continues with the proxied connections.
+	AddUpStream(address string, connectTimeout time.Duration, opts ...UpstreamOption)
+	// RemoveUpStream removes the upstream, the proxied connections to the upstream are kept.
+	// Returns false if the upstream not found.
+	RemoveUpStream(address string) bool
+	// DrainUpStream stops proxying the new connections to the upstream, and waits for the
+	// proxied connections to the upstream finished, the upstream is removed after drained.
+	// The remaining connections are closed if the ctx is done before drained, and the error
+	// of the ctx is returned.
+	DrainUpStream(ctx context.Context, address string) error
+	// UpStreams returns the stats of the upstreams
+	UpStreams() []UpstreamStats
+	// SetUpStreams replaces all the upstreams atomically, the state of the existing upstreams
+	// with the same address is kept, e.g. the health and the counters. The draining upstreams
+	// are replaced by new upstreams as AddUpStream does.
+	SetUpStreams(upstreams []UpstreamConfig)
+	// Connections returns the stats of the proxied connections
+	Connections() []ProxyConnStats
 }
 
-// NewProxy returns a simple tcp proxy
-func NewProxy[IN any, OUT any](address string, logger *zap.Logger) Proxy {
-	return &proxy[IN, OUT]{
+// UpstreamConfig the config of an upstream to be set by SetUpStreams
+type UpstreamConfig struct {
+	// Address address of the upstream
+	Address string
+	// ConnectTimeout timeout to connect the upstream
+	ConnectTimeout time.Duration
+	// Weight weight of the upstream used by the Balancer, default is 1
+	Weight int
+}
+
+// UpstreamStats the stats of an upstream
+type UpstreamStats struct {
+	// Address address of the upstream
+	Address string
+	// Weight weight of the upstream
+	Weight int
+	// Healthy false if the upstream is marked unhealthy by the health check
+	Healthy bool
+	// Draining true if the upstream is draining by DrainUpStream
+	Draining bool
+	// CircuitOpen true if the circuit breaker of the upstream is open or half-open
+	CircuitOpen bool
+	// ActiveConns number of the active proxied connections to the upstream
+	ActiveConns int
+	// ClientBytes total bytes forwarded from the clients to the upstream
+	ClientBytes int64
+	// UpstreamBytes total bytes forwarded from the upstream to the clients
+	UpstreamBytes int64
+}
+
+// ProxyConnStats the stats of a proxied connection
+type ProxyConnStats struct {
+	// ID the session id of the client connection
+	ID uint64
+	// ClientAddress remote address of the client connection
+	ClientAddress string
+	// UpstreamAddress address of the upstream
+	UpstreamAddress string
+	// ClientBytes bytes forwarded from the client to the upstream
+	ClientBytes int64
+	// UpstreamBytes bytes forwarded from the upstream to the client
+	UpstreamBytes int64
+}
+
+// ProxyOption proxy option
+type ProxyOption func(*proxyOptions)
+
+type proxyOptions struct {
+	connClosed     func(ProxyConnStats)
+	healthCheck    *HealthCheckConfig
+	balancer       Balancer
+	retry          ProxyRetryConfig
+	circuitBreaker *CircuitBreakerConfig
+	// proxyHeader the version of the PROXY protocol header sent to the upstreams
+	proxyHeader   int
+	proxyProtocol *ProxyProtocolConfig
+}
+
+// UpstreamOption upstream option
+type UpstreamOption func(*upstream)
+
+// WithUpstreamWeight set the weight of the upstream used by the Balancer, default is 1
+func WithUpstreamWeight(weight int) UpstreamOption {
+	return func(up *upstream) {
+		up.weight = weight
+	}
+}
+
+// WithProxyBalancer set the Balancer to select the upstream for the client connections,
+// default is the round robin Balancer.
+func WithProxyBalancer(balancer Balancer) ProxyOption {
+	return func(opts *proxyOptions) {
+		opts.balancer = balancer
+	}
+}
+
+// WithProxyConnClosed set a func to be called with the final stats after a proxied connection
+// closed
+func WithProxyConnClosed(value func(ProxyConnStats)) ProxyOption {
+	return func(opts *proxyOptions) {
+		opts.connClosed = value
+	}
+}
+
+// WithProxyProtocolHeader sends the PROXY protocol header of the version 1 or 2 to the
+// upstream before forwarding, so the upstream knows the address of the client. The TLVs of
+// the header received from the client are forwarded in the version 2.
+func WithProxyProtocolHeader(version int) ProxyOption {
+	return func(opts *proxyOptions) {
+		opts.proxyHeader = version
+	}
+}
+
+// WithProxyAcceptProxyProtocol accepts the client connections with the PROXY protocol header,
+// e.g. the proxy is behind another load balancer.
+func WithProxyAcceptProxyProtocol(cfg ProxyProtocolConfig) ProxyOption {
+	return func(opts *proxyOptions) {
+		opts.proxyProtocol = &cfg
+	}
+}
+
+// NewProxy returns a simple tcp proxy. The bytes are forwarded between the raw connections, so
+// the splice is used on linux for the plain tcp connections, and the half-close is forwarded
+// to the other side.
+func NewProxy[IN any, OUT any](address string, logger *zap.Logger, opts ...ProxyOption) Proxy {
+	return newProxy[IN, OUT](address, logger, opts...)
+}
+
+func newProxy[IN any, OUT any](address string, logger *zap.Logger, opts ...ProxyOption) *proxy[IN, OUT] {
+	p := &proxy[IN, OUT]{
 		address: address,
 		logger:  adjustLogger(logger),
 	}
+	for _, opt := range opts {
+		opt(&p.options)
+	}
+	if p.options.balancer == nil {
+		p.options.balancer = NewRoundRobinBalancer()
+	}
+	if p.options.retry.MaxAttempts <= 0 {
+		p.options.retry.MaxAttempts = 1
+	}
+	p.mu.conns = make(map[uint64]*proxyConn)
+	if p.options.healthCheck != nil {
+		p.health = newHealthChecker(p, *p.options.healthCheck)
+	}
+	return p
 }
 
 type proxy[IN any, OUT any] struct {
 	logger  *zap.Logger
 	address string
 	server  NetApplication[IN, OUT]
-	mu      struct {
+	options proxyOptions
+	health  *healthChecker[IN, OUT]
+	// messages is set if the messages are routed instead of forwarding the bytes
+	messages *messageProxy[IN, OUT]
+	mu       struct {
 		sync.Mutex
-		seq          uint64
 		upstreamList []*upstream
+		conns        map[uint64]*proxyConn
+		// infos the reused UpstreamInfos to select by the Balancer
+		infos []UpstreamInfo
+		// candidates the upstreams of the infos
+		candidates []*upstream
 	}
 }
 
 func (p *proxy[IN, OUT]) Start() error {
-	server, err := NewApplication(
-		p.address,
-		nil,
-		WithAppHandleSessionFunc(p.handleSession))
+	var handleFunc func(IOSession[IN, OUT], IN, uint64) error
+	var opts []AppOption[IN, OUT]
+	if p.messages != nil {
+		p.messages.pool = NewSessionPool(p.messages.poolOptions()...)
+		handleFunc = p.handleMessage
+		opts = append(opts, WithAppSessionOptions(WithSessionCodec(p.messages.cfg.Codec)))
+	} else {
+		opts = append(opts, WithAppHandleSessionFunc(p.handleSession))
+	}
+	if p.options.proxyProtocol != nil {
+		opts = append(opts, WithAppProxyProtocol[IN, OUT](*p.options.proxyProtocol))
+	}
+	server, err := NewApplication(p.address, handleFunc, opts...)
 	if err != nil {
+		if p.messages != nil {
+			p.messages.pool.Close()
+		}
 		return err
 	}
 	p.server = server
-	return p.server.Start()
+	if err := p.server.Start(); err != nil {
+		return err
+	}
+	if p.health != nil {
+		p.health.start()
+	}
+	return nil
 }
 
 func (p *proxy[IN, OUT]) Stop() error {
-	return p.server.Stop()
+	if p.health != nil {
+		p.health.stop()
+	}
+	err := p.server.Stop()
+	if p.messages != nil {
+		if cerr := p.messages.pool.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
 }
 
-func (p *proxy[IN, OUT]) AddUpStream(address string, connectTimeout time.Duration) {
-	p.mu.Lock()
-	defer p.mu.Unlock()
-	p.mu.upstreamList = append(p.mu.upstreamList, &upstream{
+func (p *proxy[IN, OUT]) AddUpStream(address string, connectTimeout time.Duration, opts ...UpstreamOption) {
+	up := &upstream{
 		address:        address,
 		connectTimeout: connectTimeout,
-	})
+	}
+	for _, opt := range opts {
+		opt(up)
+	}
+	if up.weight <= 0 {
+		up.weight = 1
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for idx, v := range p.mu.upstreamList {
+		if v.address == address {
+			if v.drainedC != nil {
+				p.mu.upstreamList[idx] = up
+				return
+			}
+			v.connectTimeout = up.connectTimeout
+			v.weight = up.weight
+			return
+		}
+	}
+	p.mu.upstreamList = append(p.mu.upstreamList, up)
+}
+
+func (p *proxy[IN, OUT]) RemoveUpStream(address string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.removeUpStreamLocked(address) != nil
+}
+
+func (p *proxy[IN, OUT]) DrainUpStream(ctx context.Context, address string) error {
+	p.mu.Lock()
+	var up *upstream
+	for _, v := range p.mu.upstreamList {
+		if v.address == address {
+			up = v
+			break
+		}
+	}
+	if up == nil {
+		p.mu.Unlock()
+		return fmt.Errorf("upstream %s not found", address)
+	}
+	if up.drainedC == nil {
+		up.drainedC = make(chan struct{})
+		if up.activeConns == 0 {
+			close(up.drainedC)
+		}
+	}
+	drainedC := up.drainedC
+	p.mu.Unlock()
+
+	select {
+	case <-drainedC:
+		p.mu.Lock()
+		p.removeDrainedUpStreamLocked(up)
+		p.mu.Unlock()
+		return nil
+	case <-ctx.Done():
+	}
+
+	// close the remaining connections, and the connections dialing to the upstream
+	p.mu.Lock()
+	up.closed = true
+	p.removeDrainedUpStreamLocked(up)
+	for _, pc := range p.mu.conns {
+		if pc.upstream == up {
+			pc.close()
+		}
+	}
+	p.mu.Unlock()
+	p.logger.Warn("upstream drain timeout, the remaining connections closed",
+		zap.String("upstream", address))
+	return ctx.Err()
+}
+
+func (p *proxy[IN, OUT]) UpStreams() []UpstreamStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stats := make([]UpstreamStats, 0, len(p.mu.upstreamList))
+	for _, up := range p.mu.upstreamList {
+		s := UpstreamStats{
+			Address:       up.address,
+			Weight:        up.weight,
+			Healthy:       !up.health.unhealthy,
+			Draining:      up.drainedC != nil,
+			CircuitOpen:   up.breaker.isOpen(),
+			ActiveConns:   up.activeConns,
+			ClientBytes:   up.clientBytes,
+			UpstreamBytes: up.upstreamBytes,
+		}
+		for _, pc := range p.mu.conns {
+			if pc.upstream == up {
+				s.ClientBytes += atomic.LoadInt64(&pc.clientBytes)
+				s.UpstreamBytes += atomic.LoadInt64(&pc.upstreamBytes)
+			}
+		}
+		stats = append(stats, s)
+	}
+	return stats
+}
+
+func (p *proxy[IN, OUT]) SetUpStreams(upstreams []UpstreamConfig) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	existing := make(map[string]*upstream, len(p.mu.upstreamList))
+	for _, up := range p.mu.upstreamList {
+		// the draining upstream is replaced if the address is declared again
+		if up.drainedC == nil {
+			existing[up.address] = up
+		}
+	}
+	list := make([]*upstream, 0, len(upstreams))
+	added := make(map[string]struct{}, len(upstreams))
+	for _, cfg := range upstreams {
+		up, ok := existing[cfg.Address]
+		if !ok {
+			up = &upstream{address: cfg.Address}
+			existing[cfg.Address] = up
+		}
+		// the last config is used if the address is duplicated
+		up.connectTimeout = cfg.ConnectTimeout
+		up.weight = cfg.Weight
+		if up.weight <= 0 {
+			up.weight = 1
+		}
+		if _, ok := added[cfg.Address]; !ok {
+			added[cfg.Address] = struct{}{}
+			list = append(list, up)
+		}
+	}
+	p.mu.upstreamList = list
+}
+
+// removeDrainedUpStreamLocked removes the drained upstream from the list, nothing to do if
+// the upstream is already removed or replaced by AddUpStream or SetUpStreams.
+func (p *proxy[IN, OUT]) removeDrainedUpStreamLocked(up *upstream) {
+	for idx, v := range p.mu.upstreamList {
+		if v == up {
+			p.mu.upstreamList = append(p.mu.upstreamList[:idx:idx], p.mu.upstreamList[idx+1:]...)
+			return
+		}
+	}
+}
+
+// removeUpStreamLocked removes the upstream from the list, returns nil if not found
+func (p *proxy[IN, OUT]) removeUpStreamLocked(address string) *upstream {
+	for idx, up := range p.mu.upstreamList {
+		if up.address == address {
+			p.mu.upstreamList = append(p.mu.upstreamList[:idx:idx], p.mu.upstreamList[idx+1:]...)
+			return up
+		}
+	}
+	return nil
+}
+
+func (p *proxy[IN, OUT]) Connections() []ProxyConnStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := make([]ProxyConnStats, 0, len(p.mu.conns))
+	for _, pc := range p.mu.conns {
+		stats = append(stats, pc.stats())
+	}
+	return stats
 }
 
-func (p *proxy[IN, OUT]) getUpStream() *upstream {
+// getUpStream returns the healthy upstream selected by the Balancer, and increases the active
+// connections of the upstream. The upstreams tried already and the upstreams whose circuit is
+// open are skipped.
+func (p *proxy[IN, OUT]) getUpStream(client net.Addr, tried []*upstream) *upstream {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	n := uint64(len(p.mu.upstreamList))
-	if n == 0 {
+	now := time.Now()
+	p.mu.infos = p.mu.infos[:0]
+	p.mu.candidates = p.mu.candidates[:0]
+OUTER:
+	for _, up := range p.mu.upstreamList {
+		if up.health.unhealthy || up.drainedC != nil {
+			continue
+		}
+		if p.options.circuitBreaker != nil && !up.breaker.allow(now) {
+			continue
+		}
+		for _, v := range tried {
+			if v == up {
+				continue OUTER
+			}
+		}
+		p.mu.infos = append(p.mu.infos, UpstreamInfo{
+			Address:     up.address,
+			Weight:      up.weight,
+			ActiveConns: up.activeConns,
+		})
+		p.mu.candidates = append(p.mu.candidates, up)
+	}
+	if len(p.mu.candidates) == 0 {
 		return nil
 	}
-	up := p.mu.upstreamList[p.mu.seq%n]
-	p.mu.seq++
+
+	up := p.mu.candidates[p.options.balancer.Select(client, p.mu.infos)]
+	up.activeConns++
+	if p.options.circuitBreaker != nil {
+		up.breaker.onSelected()
+	}
+	for idx := range p.mu.candidates {
+		p.mu.candidates[idx] = nil
+	}
 	return up
 }
 
-func (p *proxy[IN, OUT]) handleSession(conn IOSession[IN, OUT]) error {
-	upstream := p.getUpStream()
-	if upstream == nil {
-		return errors.New("no upstream")
+// connectTimeout returns the connect timeout of the upstream
+func (p *proxy[IN, OUT]) connectTimeout(up *upstream) time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return up.connectTimeout
+}
+
+// releaseUpStream decreases the active connections of the upstream
+func (p *proxy[IN, OUT]) releaseUpStream(up *upstream) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	up.activeConns--
+	if up.activeConns == 0 && up.drainedC != nil {
+		close(up.drainedC)
 	}
-	upstreamConn := NewIOSession[IN, OUT]()
-	err := upstreamConn.Connect(upstream.address, upstream.connectTimeout)
+}
+
+func (p *proxy[IN, OUT]) upstreams() []*upstream {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]*upstream(nil), p.mu.upstreamList...)
+}
+
+func (p *proxy[IN, OUT]) handleSession(conn IOSession[IN, OUT]) error {
+	upstream, upstreamConn, err := p.dial(conn.RawConn().RemoteAddr())
 	if err != nil {
 		return err
 	}
+	defer p.releaseUpStream(upstream)
 
 	defer func() {
 		if err := upstreamConn.Close(); err != nil {
@@ -95,31 +488,274 @@ func (p *proxy[IN, OUT]) handleSession(conn IOSession[IN, OUT]) error {
 		}
 	}()
 
+	if p.options.proxyHeader > 0 {
+		if err := p.writeProxyHeader(conn.RawConn(), upstreamConn.RawConn(), upstream); err != nil {
+			p.logger.Error("write proxy protocol header failed",
+				zap.String("upstream", upstream.address),
+				zap.Error(err))
+			return err
+		}
+	}
+
+	pc := &proxyConn{
+		id:              conn.ID(),
+		clientAddress:   conn.RemoteAddress(),
+		upstreamAddress: upstream.address,
+		upstream:        upstream,
+		conns:           [2]net.Conn{conn.RawConn(), upstreamConn.RawConn()},
+	}
+	p.addConn(pc)
+	defer p.removeConn(pc)
+	return p.forward(pc, conn, upstreamConn)
+}
+
+// writeProxyHeader writes the PROXY protocol header with the addresses of the client conn to
+// the upstream conn
+func (p *proxy[IN, OUT]) writeProxyHeader(client, conn net.Conn, up *upstream) error {
+	header := &ProxyHeader{
+		Version:         p.options.proxyHeader,
+		SourceAddr:      client.RemoteAddr(),
+		DestinationAddr: client.LocalAddr(),
+	}
+	if received, ok := ProxyHeaderOf(client); ok {
+		header.TLVs = received.TLVs
+	}
+
+	if timeout := p.connectTimeout(up); timeout > 0 {
+		if err := conn.SetWriteDeadline(time.Now().Add(timeout)); err != nil {
+			return err
+		}
+		defer conn.SetWriteDeadline(time.Time{})
+	}
+	_, err := header.WriteTo(conn)
+	return err
+}
+
+// dial dials the upstreams selected by the Balancer until succeeded or the retry config
+// reached, the failed upstreams are not tried again.
+func (p *proxy[IN, OUT]) dial(client net.Addr) (*upstream, IOSession[IN, OUT], error) {
+	var upstreamConn IOSession[IN, OUT]
+	up, err := p.connect(client, func(up *upstream, timeout time.Duration) error {
+		upstreamConn = NewIOSession[IN, OUT]()
+		return upstreamConn.Connect(up.address, timeout)
+	})
+	return up, upstreamConn, err
+}
+
+// connect calls the connect func with the upstreams selected by the Balancer until succeeded
+// or the retry config reached. The selected upstream is returned with the active connections
+// increased, which should be released by releaseUpStream.
+func (p *proxy[IN, OUT]) connect(
+	client net.Addr,
+	connect func(up *upstream, timeout time.Duration) error) (*upstream, error) {
+	var deadline time.Time
+	if p.options.retry.Budget > 0 {
+		deadline = time.Now().Add(p.options.retry.Budget)
+	}
+
+	var tried []*upstream
+	err := errors.New("no upstream")
+	for attempt := 1; attempt <= p.options.retry.MaxAttempts; attempt++ {
+		up := p.getUpStream(client, tried)
+		if up == nil {
+			break
+		}
+		tried = append(tried, up)
+
+		timeout := p.connectTimeout(up)
+		if !deadline.IsZero() {
+			remaining := time.Until(deadline)
+			if remaining <= 0 {
+				p.mu.Lock()
+				up.breaker.trying = false
+				p.mu.Unlock()
+				p.releaseUpStream(up)
+				break
+			}
+			if timeout <= 0 || timeout > remaining {
+				timeout = remaining
+			}
+		}
+
+		err = connect(up, timeout)
+		p.onDial(up, err)
+		if err == nil {
+			return up, nil
+		}
+
+		p.releaseUpStream(up)
+		p.logger.Warn("dial upstream failed",
+			zap.String("upstream", up.address),
+			zap.Int("attempt", attempt),
+			zap.Error(err))
+	}
+	return nil, err
+}
+
+// onDial updates the health and the circuit breaker of the upstream by the dial result
+func (p *proxy[IN, OUT]) onDial(up *upstream, err error) {
+	// the upstream is not dialed if the pool of the message proxy is exhausted
+	if errors.Is(err, ErrPoolExhausted) {
+		p.mu.Lock()
+		up.breaker.trying = false
+		p.mu.Unlock()
+		return
+	}
+	if p.health != nil {
+		p.health.onDial(up, err)
+	}
+	if p.options.circuitBreaker == nil {
+		return
+	}
+
+	p.mu.Lock()
+	opened := up.breaker.onDial(err == nil, time.Now(), p.options.circuitBreaker)
+	p.mu.Unlock()
+	if opened {
+		p.logger.Warn("upstream circuit opened",
+			zap.String("upstream", up.address),
+			zap.Duration("cool-down", p.options.circuitBreaker.CoolDown))
+	}
+}
+
+// forward forwards the bytes between the client and the upstream until both directions
+// finished. Once a direction reaches EOF, the write side of the other connection is closed
+// and the other direction keeps forwarding. Both connections are closed if any direction
+// failed.
+func (p *proxy[IN, OUT]) forward(pc *proxyConn, conn, upstreamConn IOSession[IN, OUT]) error {
 	srcConn := conn.RawConn()
 	dstConn := upstreamConn.RawConn()
 
 	var wg sync.WaitGroup
+	var upstreamErr error
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		_, err := io.Copy(srcConn, dstConn)
-		if err != nil {
+		upstreamErr = copyAndCloseWrite(srcConn, dstConn, upstreamConn.InBuf(), &pc.upstreamBytes)
+		if upstreamErr != nil {
 			p.logger.Error("copy data from upstream to client failed",
-				zap.String("upstream", upstream.address),
-				zap.Error(err))
+				zap.String("upstream", pc.upstreamAddress),
+				zap.Error(upstreamErr))
+			srcConn.Close()
+			dstConn.Close()
 		}
 	}()
-	_, err = io.Copy(dstConn, srcConn)
+	err := copyAndCloseWrite(dstConn, srcConn, conn.InBuf(), &pc.clientBytes)
 	if err != nil {
 		p.logger.Error("copy data from client to upstream failed",
-			zap.String("upstream", upstream.address),
+			zap.String("upstream", pc.upstreamAddress),
 			zap.Error(err))
+		srcConn.Close()
+		dstConn.Close()
 	}
 	wg.Wait()
+	if err == nil {
+		err = upstreamErr
+	}
 	return err
 }
 
+func (p *proxy[IN, OUT]) addConn(pc *proxyConn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.mu.conns[pc.id] = pc
+	if pc.upstream.closed {
+		// the upstream drain timeout while dialing
+		pc.close()
+	}
+}
+
+func (p *proxy[IN, OUT]) removeConn(pc *proxyConn) {
+	p.mu.Lock()
+	delete(p.mu.conns, pc.id)
+	pc.upstream.clientBytes += atomic.LoadInt64(&pc.clientBytes)
+	pc.upstream.upstreamBytes += atomic.LoadInt64(&pc.upstreamBytes)
+	p.mu.Unlock()
+	if p.options.connClosed != nil {
+		p.options.connClosed(pc.stats())
+	}
+}
+
+// copyAndCloseWrite drains the bytes buffered in the in buffer of the src, and then copies
+// from the src to the dst until EOF, and closes the write side of the dst. The bytes are
+// copied in chunks to update the counter, the *io.LimitedReader keeps the splice of the
+// net.Conn available.
+func copyAndCloseWrite(dst, src net.Conn, buffered *buf.ByteBuf, counter *int64) error {
+	if buffered != nil && buffered.Readable() > 0 {
+		n, err := buffered.WriteTo(dst)
+		atomic.AddInt64(counter, n)
+		if err != nil {
+			return err
+		}
+	}
+
+	copyBuf := acquireCopyBuf(defaultProxyCopyChunkSize)
+	defer releaseCopyBuf(defaultProxyCopyChunkSize, copyBuf)
+	for {
+		n, err := io.CopyBuffer(dst, &io.LimitedReader{R: src, N: defaultProxyCopyChunkSize}, *copyBuf)
+		atomic.AddInt64(counter, n)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				// closed by the other direction
+				return nil
+			}
+			return err
+		}
+		if n < defaultProxyCopyChunkSize {
+			break
+		}
+	}
+
+	if cw, ok := dst.(interface{ CloseWrite() error }); ok {
+		if err := cw.CloseWrite(); err != nil && !errors.Is(err, net.ErrClosed) {
+			return err
+		}
+	}
+	return nil
+}
+
 type upstream struct {
-	address        string
+	address string
+	// the fields below are protected by the lock of the proxy, the config can be changed by
+	// AddUpStream and SetUpStreams
 	connectTimeout time.Duration
+	weight         int
+	activeConns    int
+	health         upstreamHealth
+	breaker        circuitBreaker
+	// drainedC is created by DrainUpStream, and closed once no active connections
+	drainedC chan struct{}
+	// closed the connections are closed since drain timeout
+	closed bool
+	// clientBytes and upstreamBytes the bytes forwarded by the closed connections
+	clientBytes   int64
+	upstreamBytes int64
+}
+
+// proxyConn a proxied connection
+type proxyConn struct {
+	id              uint64
+	clientAddress   string
+	upstreamAddress string
+	clientBytes     int64
+	upstreamBytes   int64
+	upstream        *upstream
+	conns           [2]net.Conn
+}
+
+// close closes the client and upstream connections to stop forwarding
+func (pc *proxyConn) close() {
+	for _, conn := range pc.conns {
+		conn.Close()
+	}
+}
+
+func (pc *proxyConn) stats() ProxyConnStats {
+	return ProxyConnStats{
+		ID:              pc.id,
+		ClientAddress:   pc.clientAddress,
+		UpstreamAddress: pc.upstreamAddress,
+		ClientBytes:     atomic.LoadInt64(&pc.clientBytes),
+		UpstreamBytes:   atomic.LoadInt64(&pc.upstreamBytes),
+	}
 }
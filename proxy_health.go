@@ -0,0 +1,250 @@
+package goetty
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// HealthProbe probes the upstream, returns nil if the upstream is healthy
+type HealthProbe func(address string, timeout time.Duration) error
+
+// HealthCheckConfig the health check config of the proxy upstreams
+type HealthCheckConfig struct {
+	// Interval between two active probes of each upstream, default is 5s
+	Interval time.Duration
+	// Timeout of each probe, default is the connect timeout of the upstream, or 3s if the
+	// connect timeout is 0
+	Timeout time.Duration
+	// Rise number of consecutive successful probes to mark an unhealthy upstream healthy,
+	// default is 2
+	Rise int
+	// Fall number of consecutive failed probes to mark a healthy upstream unhealthy, default
+	// is 3
+	Fall int
+	// MaxDialFailures number of consecutive failures to dial the upstream for the proxied
+	// connections to mark the upstream unhealthy passively, 0 disables the passive ejection.
+	MaxDialFailures int
+	// Probe probes the upstream, default is to connect the upstream by tcp
+	Probe HealthProbe
+	// OnChange is called after the upstream marked healthy or unhealthy
+	OnChange func(address string, healthy bool)
+}
+
+// WithProxyHealthCheck enable the health check of the upstreams. The unhealthy upstreams are
+// skipped until they are marked healthy by the active probes again.
+func WithProxyHealthCheck(cfg HealthCheckConfig) ProxyOption {
+	return func(opts *proxyOptions) {
+		opts.healthCheck = &cfg
+	}
+}
+
+// NewSessionHealthProbe returns a HealthProbe which connects the upstream by an IOSession
+// created with the opts, writes the request and checks the response.
+func NewSessionHealthProbe[IN any, OUT any](request OUT, check func(IN) error, opts ...Option[IN, OUT]) HealthProbe {
+	return func(address string, timeout time.Duration) error {
+		rs := NewIOSession(opts...)
+		defer rs.Close()
+		if err := rs.Connect(address, timeout); err != nil {
+			return err
+		}
+		if err := rs.Write(request, WriteOptions{Timeout: timeout, Flush: true}); err != nil {
+			return err
+		}
+		resp, err := rs.Read(ReadOptions{Timeout: timeout})
+		if err != nil {
+			return err
+		}
+		return check(resp)
+	}
+}
+
+func (cfg *HealthCheckConfig) adjust() {
+	if cfg.Interval <= 0 {
+		cfg.Interval = defaultHealthCheckInterval
+	}
+	if cfg.Rise <= 0 {
+		cfg.Rise = defaultHealthCheckRise
+	}
+	if cfg.Fall <= 0 {
+		cfg.Fall = defaultHealthCheckFall
+	}
+	if cfg.Probe == nil {
+		cfg.Probe = dialProbe
+	}
+	if cfg.OnChange == nil {
+		cfg.OnChange = func(string, bool) {}
+	}
+}
+
+// dialProbe the default probe to connect the upstream
+func dialProbe(address string, timeout time.Duration) error {
+	network, address, err := parseAddress(address)
+	if err != nil {
+		return err
+	}
+	conn, err := net.DialTimeout(network, address, timeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// healthChecker probes the upstreams of the proxy in the interval
+type healthChecker[IN any, OUT any] struct {
+	p        *proxy[IN, OUT]
+	cfg      HealthCheckConfig
+	stopC    chan struct{}
+	stopOnce sync.Once
+	stopped  sync.WaitGroup
+}
+
+func newHealthChecker[IN any, OUT any](p *proxy[IN, OUT], cfg HealthCheckConfig) *healthChecker[IN, OUT] {
+	cfg.adjust()
+	return &healthChecker[IN, OUT]{
+		p:     p,
+		cfg:   cfg,
+		stopC: make(chan struct{}),
+	}
+}
+
+func (hc *healthChecker[IN, OUT]) start() {
+	hc.stopped.Add(1)
+	go hc.run()
+}
+
+func (hc *healthChecker[IN, OUT]) stop() {
+	hc.stopOnce.Do(func() {
+		close(hc.stopC)
+	})
+	hc.stopped.Wait()
+}
+
+func (hc *healthChecker[IN, OUT]) run() {
+	defer hc.stopped.Done()
+
+	timer := time.NewTicker(hc.cfg.Interval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-hc.stopC:
+			return
+		case <-timer.C:
+			hc.probeAll()
+		}
+	}
+}
+
+// probeAll probes all the upstreams concurrently
+func (hc *healthChecker[IN, OUT]) probeAll() {
+	var wg sync.WaitGroup
+	for _, up := range hc.p.upstreams() {
+		wg.Add(1)
+		go func(up *upstream) {
+			defer wg.Done()
+			hc.probe(up)
+		}(up)
+	}
+	wg.Wait()
+}
+
+func (hc *healthChecker[IN, OUT]) probe(up *upstream) {
+	timeout := hc.cfg.Timeout
+	if timeout <= 0 {
+		timeout = hc.p.connectTimeout(up)
+	}
+	if timeout <= 0 {
+		timeout = defaultHealthCheckTimeout
+	}
+	err := hc.cfg.Probe(up.address, timeout)
+	if err != nil {
+		hc.p.logger.Debug("upstream probe failed",
+			zap.String("upstream", up.address),
+			zap.Error(err))
+	}
+
+	p := hc.p
+	p.mu.Lock()
+	changed := up.health.onProbe(err == nil, hc.cfg.Rise, hc.cfg.Fall)
+	healthy := !up.health.unhealthy
+	p.mu.Unlock()
+	if changed {
+		hc.onChange(up, healthy, err)
+	}
+}
+
+// onDial updates the passive health of the upstream after dialed for a proxied connection
+func (hc *healthChecker[IN, OUT]) onDial(up *upstream, err error) {
+	p := hc.p
+	p.mu.Lock()
+	changed := up.health.onDial(err == nil, hc.cfg.MaxDialFailures)
+	p.mu.Unlock()
+	if changed {
+		hc.onChange(up, false, err)
+	}
+}
+
+func (hc *healthChecker[IN, OUT]) onChange(up *upstream, healthy bool, err error) {
+	if healthy {
+		hc.p.logger.Info("upstream is healthy",
+			zap.String("upstream", up.address))
+	} else {
+		hc.p.logger.Warn("upstream is unhealthy",
+			zap.String("upstream", up.address),
+			zap.Error(err))
+	}
+	hc.cfg.OnChange(up.address, healthy)
+}
+
+// upstreamHealth the health state of an upstream, protected by the lock of the proxy
+type upstreamHealth struct {
+	unhealthy    bool
+	successes    int
+	failures     int
+	dialFailures int
+}
+
+// onProbe updates the health by the probe result, returns true if the health changed
+func (h *upstreamHealth) onProbe(ok bool, rise, fall int) bool {
+	if ok {
+		h.failures = 0
+		h.successes++
+		if h.unhealthy && h.successes >= rise {
+			h.setHealthy(true)
+			return true
+		}
+		return false
+	}
+
+	h.successes = 0
+	h.failures++
+	if !h.unhealthy && h.failures >= fall {
+		h.setHealthy(false)
+		return true
+	}
+	return false
+}
+
+// onDial updates the health by the dial result, returns true if the upstream ejected
+func (h *upstreamHealth) onDial(ok bool, maxFailures int) bool {
+	if ok {
+		h.dialFailures = 0
+		return false
+	}
+
+	h.dialFailures++
+	if maxFailures > 0 && !h.unhealthy && h.dialFailures >= maxFailures {
+		h.setHealthy(false)
+		return true
+	}
+	return false
+}
+
+func (h *upstreamHealth) setHealthy(healthy bool) {
+	h.unhealthy = !healthy
+	h.successes = 0
+	h.failures = 0
+	h.dialFailures = 0
+}
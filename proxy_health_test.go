@@ -0,0 +1,146 @@
+package goetty
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/fagongzi/goetty/v3/codec/simple"
+	"github.com/lni/goutils/leaktest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProxyActiveHealthCheck(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	changeC := make(chan bool, 4)
+	proxy := newTestProxy(t, nil, WithProxyHealthCheck(HealthCheckConfig{
+		Interval: time.Millisecond * 20,
+		Rise:     1,
+		Fall:     1,
+		OnChange: func(address string, healthy bool) {
+			if address == upstream2Address {
+				changeC <- healthy
+			}
+		},
+	}))
+	defer func() {
+		assert.NoError(t, proxy.Stop())
+	}()
+
+	upstream1 := newTestUpstream(t, upstream1Address, "upstream1")
+	defer func() {
+		assert.NoError(t, upstream1.Stop())
+	}()
+	upstream2 := newTestUpstream(t, upstream2Address, "upstream2")
+	proxy.AddUpStream(upstream1Address, time.Second)
+	proxy.AddUpStream(upstream2Address, time.Second)
+
+	assert.NoError(t, upstream2.Stop())
+	assert.False(t, <-changeC)
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, "upstream1", mustProxyRequest(t))
+	}
+
+	upstream2 = newTestUpstream(t, upstream2Address, "upstream2")
+	defer func() {
+		assert.NoError(t, upstream2.Stop())
+	}()
+	assert.True(t, <-changeC)
+	replies := map[string]int{}
+	for i := 0; i < 4; i++ {
+		replies[mustProxyRequest(t)]++
+	}
+	assert.Equal(t, map[string]int{"upstream1": 2, "upstream2": 2}, replies)
+}
+
+func TestProxyPassiveEjection(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	assert.NoError(t, os.RemoveAll(upstream2Address[7:]))
+	proxy := newTestProxy(t, nil, WithProxyHealthCheck(HealthCheckConfig{
+		Interval:        time.Hour,
+		MaxDialFailures: 1,
+	}))
+	defer func() {
+		assert.NoError(t, proxy.Stop())
+	}()
+
+	upstream1 := newTestUpstream(t, upstream1Address, "upstream1")
+	defer func() {
+		assert.NoError(t, upstream1.Stop())
+	}()
+	proxy.AddUpStream(upstream2Address, time.Second)
+	proxy.AddUpStream(upstream1Address, time.Second)
+
+	// the first connection dials the down upstream and fails
+	_, err := proxyRequest(t)
+	assert.Error(t, err)
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, "upstream1", mustProxyRequest(t))
+	}
+}
+
+func TestProxyHealthCheckDefaultTimeout(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	timeoutC := make(chan time.Duration, 1)
+	proxy := newTestProxy(t, nil, WithProxyHealthCheck(HealthCheckConfig{
+		Interval: time.Millisecond * 20,
+		Probe: func(address string, timeout time.Duration) error {
+			select {
+			case timeoutC <- timeout:
+			default:
+			}
+			return nil
+		},
+	}))
+	proxy.AddUpStream(upstream1Address, 0)
+	assert.Equal(t, defaultHealthCheckTimeout, <-timeoutC)
+
+	// stop twice
+	assert.NoError(t, proxy.Stop())
+	assert.NoError(t, proxy.Stop())
+}
+
+func TestSessionHealthProbe(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	upstream1 := newTestUpstream(t, upstream1Address, "upstream1")
+	defer func() {
+		assert.NoError(t, upstream1.Stop())
+	}()
+
+	probe := func(expect string) HealthProbe {
+		return NewSessionHealthProbe("ping", func(resp string) error {
+			if resp != expect {
+				return errors.New("unexpected response")
+			}
+			return nil
+		}, WithSessionCodec[string, string](simple.NewStringCodec()))
+	}
+	assert.NoError(t, probe("upstream1")(upstream1Address, time.Second))
+	assert.Error(t, probe("upstream2")(upstream1Address, time.Second))
+	assert.Error(t, probe("upstream2")(upstream2Address, time.Second))
+}
+
+func TestUpstreamHealth(t *testing.T) {
+	var h upstreamHealth
+	assert.False(t, h.onProbe(false, 2, 2))
+	assert.False(t, h.onProbe(true, 2, 2))
+	assert.False(t, h.onProbe(false, 2, 2))
+	assert.True(t, h.onProbe(false, 2, 2))
+	assert.True(t, h.unhealthy)
+
+	assert.False(t, h.onProbe(true, 2, 2))
+	assert.True(t, h.onProbe(true, 2, 2))
+	assert.False(t, h.unhealthy)
+
+	assert.False(t, h.onDial(false, 0))
+	assert.False(t, h.onDial(true, 2))
+	assert.False(t, h.onDial(false, 2))
+	assert.False(t, h.unhealthy)
+	assert.True(t, h.onDial(false, 2))
+	assert.True(t, h.unhealthy)
+}
@@ -0,0 +1,184 @@
+package goetty
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/fagongzi/goetty/v3/codec"
+	"go.uber.org/zap"
+)
+
+// Router returns the address of the upstream to handle the request decoded from the client,
+// e.g. sharding by the key of the request. The upstream must be added to the Proxy, returns
+// "" to select the upstream by the Balancer.
+type Router[IN any] func(request IN) (string, error)
+
+// MessageProxyConfig the config of the Proxy which routes the decoded messages
+type MessageProxyConfig[IN any, OUT any] struct {
+	// Codec the codec of the client sessions, decodes the requests and encodes the responses
+	Codec codec.Codec[IN, OUT]
+	// UpstreamCodec the codec of the upstream sessions, encodes the requests and decodes the
+	// responses
+	UpstreamCodec codec.Codec[OUT, IN]
+	// Router routes the requests, nil means all requests are routed by the Balancer
+	Router Router[IN]
+	// RequestTimeout max time to write the request to the upstream and read the response,
+	// default is 10s
+	RequestTimeout time.Duration
+	// UpstreamSessionOptions options to create the upstream sessions, e.g. tls
+	UpstreamSessionOptions []Option[OUT, IN]
+	// PoolOptions options of the SessionPool of the upstream sessions, e.g. the size of the
+	// pool of each upstream. The session options are set by the UpstreamSessionOptions. The
+	// max size of the pool caps the in-flight requests of each upstream, default is 8, the
+	// requests wait for a free session until the connect timeout of the upstream, or the
+	// borrow timeout of the pool if the connect timeout is 0, which is the RequestTimeout by
+	// default.
+	PoolOptions []PoolOption[OUT, IN]
+	// ErrorResponse returns the response to reply the client if failed to route or forward the
+	// request, the client session is closed if it is nil or returns false.
+	ErrorResponse func(request IN, err error) (OUT, bool)
+}
+
+// NewMessageProxy returns a Proxy which decodes the requests of the clients by the codec, and
+// forwards each request to the upstream returned by the Router, the response is written back
+// to the client. The requests of a client are forwarded one by one, so the responses are in
+// the order of the requests. The upstream sessions are borrowed from a SessionPool for each
+// request and shared by all clients, and the active connections of the upstream are the
+// in-flight requests. The retry config is only used by the requests routed by
+// the Balancer, and the connection stats, the byte counters and the PROXY protocol header are
+// not available, since a client is not bound to an upstream.
+func NewMessageProxy[IN any, OUT any](
+	address string,
+	logger *zap.Logger,
+	cfg MessageProxyConfig[IN, OUT],
+	opts ...ProxyOption) Proxy {
+	if cfg.Codec == nil || cfg.UpstreamCodec == nil {
+		panic("missing codec")
+	}
+	if cfg.RequestTimeout <= 0 {
+		cfg.RequestTimeout = defaultMessageProxyRequestTimeout
+	}
+
+	p := newProxy[IN, OUT](address, logger, opts...)
+	p.messages = &messageProxy[IN, OUT]{cfg: cfg}
+	return p
+}
+
+type messageProxy[IN any, OUT any] struct {
+	cfg  MessageProxyConfig[IN, OUT]
+	pool SessionPool[OUT, IN]
+}
+
+func (m *messageProxy[IN, OUT]) poolOptions() []PoolOption[OUT, IN] {
+	sessionOpts := append([]Option[OUT, IN]{}, m.cfg.UpstreamSessionOptions...)
+	sessionOpts = append(sessionOpts, WithSessionCodec(m.cfg.UpstreamCodec))
+	options := []PoolOption[OUT, IN]{WithPoolBorrowTimeout[OUT, IN](m.cfg.RequestTimeout)}
+	options = append(options, m.cfg.PoolOptions...)
+	return append(options, WithPoolSessionOptions(sessionOpts...))
+}
+
+// handleMessage forwards the request to the upstream and writes the response back
+func (p *proxy[IN, OUT]) handleMessage(rs IOSession[IN, OUT], request IN, received uint64) error {
+	response, err := p.roundTrip(rs, request)
+	if err != nil {
+		p.logger.Error("forward request failed",
+			zap.Uint64("session-id", rs.ID()),
+			zap.Error(err))
+		if p.messages.cfg.ErrorResponse == nil {
+			return err
+		}
+		v, ok := p.messages.cfg.ErrorResponse(request, err)
+		if !ok {
+			return err
+		}
+		response = v
+	}
+	return rs.Write(response, WriteOptions{Flush: true})
+}
+
+func (p *proxy[IN, OUT]) roundTrip(rs IOSession[IN, OUT], request IN) (OUT, error) {
+	var response OUT
+	address := ""
+	if p.messages.cfg.Router != nil {
+		v, err := p.messages.cfg.Router(request)
+		if err != nil {
+			return response, err
+		}
+		address = v
+	}
+
+	var conn IOSession[OUT, IN]
+	connect := func(up *upstream, timeout time.Duration) error {
+		ctx := context.Background()
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		v, err := p.messages.pool.Get(ctx, up.address)
+		conn = v
+		return err
+	}
+
+	var up *upstream
+	var err error
+	if address == "" {
+		up, err = p.connect(rs.RawConn().RemoteAddr(), connect)
+	} else {
+		up, err = p.getUpStreamByAddress(address)
+		if err == nil {
+			err = connect(up, p.connectTimeout(up))
+			p.onDial(up, err)
+			if err != nil {
+				p.releaseUpStream(up)
+			}
+		}
+	}
+	if err != nil {
+		return response, err
+	}
+	defer p.releaseUpStream(up)
+	defer conn.Close()
+
+	timeout := p.messages.cfg.RequestTimeout
+	if err := conn.Write(request, WriteOptions{Timeout: timeout, Flush: true}); err != nil {
+		conn.Disconnect()
+		return response, err
+	}
+	response, err = conn.Read(ReadOptions{Timeout: timeout})
+	if err != nil {
+		// the response may be received later, the session can not be reused
+		conn.Disconnect()
+		return response, err
+	}
+	return response, nil
+}
+
+// getUpStreamByAddress returns the upstream of the address returned by the Router, and
+// increases the active connections of the upstream. Returns error if the upstream is not
+// available.
+func (p *proxy[IN, OUT]) getUpStreamByAddress(address string) (*upstream, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, up := range p.mu.upstreamList {
+		if up.address != address {
+			continue
+		}
+		switch {
+		case up.health.unhealthy:
+			return nil, fmt.Errorf("upstream %s is unhealthy", address)
+		case up.drainedC != nil:
+			return nil, fmt.Errorf("upstream %s is draining", address)
+		case p.options.circuitBreaker != nil && !up.breaker.allow(time.Now()):
+			return nil, fmt.Errorf("upstream %s circuit is open", address)
+		}
+		up.activeConns++
+		if p.options.circuitBreaker != nil {
+			up.breaker.onSelected()
+		}
+		return up, nil
+	}
+	return nil, fmt.Errorf("upstream %s not found", address)
+}
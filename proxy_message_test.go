@@ -0,0 +1,180 @@
+package goetty
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lni/goutils/leaktest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessageProxy(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	upstream1 := newTestApp(t, []string{upstream1Address}, handleTestMessageProxyRequest("1"))
+	assert.NoError(t, upstream1.Start())
+	defer upstream1.Stop()
+	upstream2 := newTestApp(t, []string{upstream2Address}, handleTestMessageProxyRequest("2"))
+	assert.NoError(t, upstream2.Start())
+	defer upstream2.Stop()
+
+	proxy := newTestProxy(t, &MessageProxyConfig[string, string]{
+		Router: func(request string) (string, error) {
+			switch {
+			case strings.HasPrefix(request, "a"):
+				return upstream1Address, nil
+			case strings.HasPrefix(request, "b"):
+				return upstream2Address, nil
+			}
+			return "", nil
+		},
+		PoolOptions: []PoolOption[string, string]{WithPoolSize[string, string](0, 1)},
+	})
+	defer proxy.Stop()
+	proxy.AddUpStream(upstream1Address, time.Second)
+	proxy.AddUpStream(upstream2Address, time.Second)
+
+	for i := 0; i < 3; i++ {
+		rs := newTestIOSession(t)
+		assert.NoError(t, rs.Connect(proxyAddress, time.Second))
+		for j := 0; j < 2; j++ {
+			assert.NoError(t, rs.Write(fmt.Sprintf("a%d", j), WriteOptions{}))
+			assert.NoError(t, rs.Write(fmt.Sprintf("b%d", j), WriteOptions{}))
+		}
+		assert.NoError(t, rs.Flush(time.Second))
+		for j := 0; j < 2; j++ {
+			for _, expect := range []string{fmt.Sprintf("1:a%d", j), fmt.Sprintf("2:b%d", j)} {
+				reply, err := rs.Read(ReadOptions{Timeout: time.Second})
+				assert.NoError(t, err)
+				assert.Equal(t, expect, reply)
+			}
+		}
+
+		// routed by the round robin balancer
+		assert.NoError(t, rs.Write("c", WriteOptions{Flush: true}))
+		reply, err := rs.Read(ReadOptions{Timeout: time.Second})
+		assert.NoError(t, err)
+		assert.Contains(t, []string{"1:c", "2:c"}, reply)
+		assert.NoError(t, rs.Close())
+	}
+
+	// the upstream sessions are reused by the clients
+	assert.Equal(t, 1, upstream1.Count())
+	assert.Equal(t, 1, upstream2.Count())
+	for _, stats := range proxy.UpStreams() {
+		assert.Equal(t, 0, stats.ActiveConns)
+	}
+}
+
+func TestMessageProxyErrorResponse(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	upstream1 := newTestApp(t, []string{upstream1Address}, handleTestMessageProxyRequest("1"))
+	assert.NoError(t, upstream1.Start())
+	defer upstream1.Stop()
+
+	proxy := newTestProxy(t, &MessageProxyConfig[string, string]{
+		Router: func(request string) (string, error) {
+			switch request {
+			case "missing", "close":
+				return upstream2Address, nil
+			case "invalid":
+				return "", errors.New("invalid request")
+			}
+			return upstream1Address, nil
+		},
+		RequestTimeout: time.Millisecond * 100,
+		ErrorResponse: func(request string, err error) (string, bool) {
+			return "error:" + request, request != "close"
+		},
+	})
+	defer proxy.Stop()
+	proxy.AddUpStream(upstream1Address, time.Second)
+
+	rs := newTestIOSession(t)
+	defer rs.Close()
+	assert.NoError(t, rs.Connect(proxyAddress, time.Second))
+	for _, request := range []string{"missing", "invalid", "timeout"} {
+		assertTestMessageProxyReply(t, rs, "hello", "1:hello")
+		assertTestMessageProxyReply(t, rs, request, "error:"+request)
+	}
+	assertTestMessageProxyReply(t, rs, "hello", "1:hello")
+
+	// the client is closed if no error response
+	assert.NoError(t, rs.Write("close", WriteOptions{Flush: true}))
+	_, err := rs.Read(ReadOptions{Timeout: time.Second})
+	assert.Error(t, err)
+	assert.False(t, isTimeoutErr(err))
+}
+
+func TestMessageProxyPoolExhausted(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	upstream1 := newTestApp(t, []string{upstream1Address},
+		func(rs IOSession[string, string], msg string, received uint64) error {
+			time.Sleep(time.Millisecond * 300)
+			return rs.Write(msg, WriteOptions{Flush: true})
+		})
+	assert.NoError(t, upstream1.Start())
+	defer upstream1.Stop()
+
+	errC := make(chan error, 1)
+	proxy := newTestProxy(t, &MessageProxyConfig[string, string]{
+		Router: func(request string) (string, error) {
+			return upstream1Address, nil
+		},
+		PoolOptions: []PoolOption[string, string]{WithPoolSize[string, string](0, 1)},
+		ErrorResponse: func(request string, err error) (string, bool) {
+			errC <- err
+			return "error:" + request, true
+		},
+	}, WithProxyCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 1, CoolDown: time.Minute}))
+	defer proxy.Stop()
+	proxy.AddUpStream(upstream1Address, time.Millisecond*100)
+
+	rs1 := newTestIOSession(t)
+	defer rs1.Close()
+	assert.NoError(t, rs1.Connect(proxyAddress, time.Second))
+	rs2 := newTestIOSession(t)
+	defer rs2.Close()
+	assert.NoError(t, rs2.Connect(proxyAddress, time.Second))
+
+	// the only session of the pool is borrowed by rs1
+	assert.NoError(t, rs1.Write("1", WriteOptions{Flush: true}))
+	time.Sleep(time.Millisecond * 50)
+	assertTestMessageProxyReply(t, rs2, "2", "error:2")
+	assert.ErrorIs(t, <-errC, ErrPoolExhausted)
+	reply, err := rs1.Read(ReadOptions{Timeout: time.Second})
+	assert.NoError(t, err)
+	assert.Equal(t, "1", reply)
+
+	// the circuit is not opened by the exhausted pool
+	assertTestMessageProxyReply(t, rs2, "3", "3")
+}
+
+func TestMessageProxyMissingCodec(t *testing.T) {
+	assert.Panics(t, func() {
+		NewMessageProxy(proxyAddress, nil, MessageProxyConfig[string, string]{})
+	})
+}
+
+// handleTestMessageProxyRequest returns a handler replies the request with the name, the
+// request "timeout" is not replied
+func handleTestMessageProxyRequest(name string) func(IOSession[string, string], string, uint64) error {
+	return func(rs IOSession[string, string], msg string, received uint64) error {
+		if msg == "timeout" {
+			return nil
+		}
+		return rs.Write(name+":"+msg, WriteOptions{Flush: true})
+	}
+}
+
+func assertTestMessageProxyReply(t *testing.T, rs IOSession[string, string], request, expect string) {
+	assert.NoError(t, rs.Write(request, WriteOptions{Flush: true}))
+	reply, err := rs.Read(ReadOptions{Timeout: time.Second})
+	assert.NoError(t, err)
+	assert.Equal(t, expect, reply)
+}
@@ -0,0 +1,585 @@
+package goetty
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// The well known TLV types of the PROXY protocol v2
+const (
+	ProxyTLVTypeALPN      byte = 0x01
+	ProxyTLVTypeAuthority byte = 0x02
+	ProxyTLVTypeCRC32C    byte = 0x03
+	ProxyTLVTypeNoop      byte = 0x04
+	ProxyTLVTypeUniqueID  byte = 0x05
+	ProxyTLVTypeSSL       byte = 0x20
+	ProxyTLVTypeNetNS     byte = 0x30
+)
+
+const (
+	proxyProtocolV1Prefix    = "PROXY "
+	proxyProtocolV1MaxLength = 107
+)
+
+var (
+	proxyProtocolV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+	errNoProxyHeader      = errors.New("no proxy protocol header")
+	errInvalidProxyHeader = errors.New("invalid proxy protocol header")
+)
+
+// ProxyHeader the PROXY protocol header sent by the load balancer before the data of the
+// client, see https://www.haproxy.org/download/2.8/doc/proxy-protocol.txt
+type ProxyHeader struct {
+	// Version 1 or 2
+	Version int
+	// Local true if the connection is not proxied, e.g. the health check of the load balancer,
+	// the real addresses of the connection are used.
+	Local bool
+	// SourceAddr address of the client
+	SourceAddr net.Addr
+	// DestinationAddr address the client connected to
+	DestinationAddr net.Addr
+	// TLVs the type-length-values of the v2 header
+	TLVs []ProxyTLV
+}
+
+// ProxyTLV a type-length-value of the PROXY protocol v2 header
+type ProxyTLV struct {
+	Type  byte
+	Value []byte
+}
+
+// ProxyProtocolConfig the config to accept the connections with the PROXY protocol header
+type ProxyProtocolConfig struct {
+	// HeaderTimeout max time to read the header after accepted, default is 5s
+	HeaderTimeout time.Duration
+	// AllowNoHeader accepts the connections without the header, which use the real addresses.
+	// By default, the connections without a valid header are closed.
+	AllowNoHeader bool
+}
+
+// WithAppProxyProtocol accepts the connections with the PROXY protocol v1 or v2 header. The
+// header is read before the session created, so the address of the client in the header is
+// returned by IOSession.RemoteAddress and used by the IPFilter and the connection limits. The
+// header is read before the TLS handshake if TLS enabled, use ProxyHeaderOf to get the header.
+func WithAppProxyProtocol[IN any, OUT any](cfg ProxyProtocolConfig) AppOption[IN, OUT] {
+	return func(s *server[IN, OUT]) {
+		s.options.proxyProtocol = &cfg
+	}
+}
+
+// ProxyHeaderOf returns the PROXY protocol header of the conn accepted by the NetApplication,
+// e.g. IOSession.RawConn(). Returns false if the conn has no header.
+func ProxyHeaderOf(conn net.Conn) (*ProxyHeader, bool) {
+	if tc, ok := conn.(*tls.Conn); ok {
+		conn = tc.NetConn()
+	}
+	if pc, ok := conn.(*proxyProtocolConn); ok && pc.header != nil {
+		return pc.header, true
+	}
+	return nil, false
+}
+
+// TLV returns the value of the first TLV with the type
+func (h *ProxyHeader) TLV(t byte) ([]byte, bool) {
+	for _, tlv := range h.TLVs {
+		if tlv.Type == t {
+			return tlv.Value, true
+		}
+	}
+	return nil, false
+}
+
+// WriteTo writes the header in the format of the version, the v1 header is UNKNOWN if the
+// addresses are not TCP, and the TLVs are only written in v2.
+func (h *ProxyHeader) WriteTo(w io.Writer) (int64, error) {
+	var data []byte
+	switch h.Version {
+	case 1:
+		data = h.formatV1()
+	case 2:
+		v, err := h.formatV2()
+		if err != nil {
+			return 0, err
+		}
+		data = v
+	default:
+		return 0, fmt.Errorf("invalid proxy protocol version %d", h.Version)
+	}
+	n, err := w.Write(data)
+	return int64(n), err
+}
+
+func (h *ProxyHeader) formatV1() []byte {
+	src, ok1 := h.SourceAddr.(*net.TCPAddr)
+	dst, ok2 := h.DestinationAddr.(*net.TCPAddr)
+	if h.Local || !ok1 || !ok2 || (src.IP.To4() == nil) != (dst.IP.To4() == nil) {
+		return []byte(proxyProtocolV1Prefix + "UNKNOWN\r\n")
+	}
+
+	proto := "TCP6"
+	if src.IP.To4() != nil {
+		proto = "TCP4"
+	}
+	return []byte(fmt.Sprintf("%s%s %s %s %d %d\r\n", proxyProtocolV1Prefix, proto,
+		src.IP.String(), dst.IP.String(), src.Port, dst.Port))
+}
+
+func (h *ProxyHeader) formatV2() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Write(proxyProtocolV2Signature)
+	if h.Local {
+		buf.WriteByte(0x20)
+	} else {
+		buf.WriteByte(0x21)
+	}
+
+	var fam byte
+	var addrs []byte
+	if !h.Local {
+		fam, addrs = formatV2Addresses(h.SourceAddr, h.DestinationAddr)
+	}
+	buf.WriteByte(fam)
+
+	length := len(addrs)
+	for _, tlv := range h.TLVs {
+		length += 3 + len(tlv.Value)
+	}
+	if length > 0xffff {
+		return nil, fmt.Errorf("too large proxy protocol header %d", length)
+	}
+	binary.Write(&buf, binary.BigEndian, uint16(length))
+	buf.Write(addrs)
+	for _, tlv := range h.TLVs {
+		buf.WriteByte(tlv.Type)
+		binary.Write(&buf, binary.BigEndian, uint16(len(tlv.Value)))
+		buf.Write(tlv.Value)
+	}
+	return buf.Bytes(), nil
+}
+
+// formatV2Addresses returns the family and the addresses of the v2 header, the UNSPEC family
+// is returned if the addresses are not supported
+func formatV2Addresses(src, dst net.Addr) (byte, []byte) {
+	ipAddrs := func(proto byte, srcIP, dstIP net.IP, srcPort, dstPort int) (byte, []byte) {
+		if src4, dst4 := srcIP.To4(), dstIP.To4(); src4 != nil && dst4 != nil {
+			return 0x10 | proto, appendV2IPAddresses(src4, dst4, srcPort, dstPort)
+		}
+		if srcIP.To16() != nil && dstIP.To16() != nil {
+			return 0x20 | proto, appendV2IPAddresses(srcIP.To16(), dstIP.To16(), srcPort, dstPort)
+		}
+		return 0, nil
+	}
+
+	switch src := src.(type) {
+	case *net.TCPAddr:
+		if dst, ok := dst.(*net.TCPAddr); ok {
+			return ipAddrs(0x01, src.IP, dst.IP, src.Port, dst.Port)
+		}
+	case *net.UDPAddr:
+		if dst, ok := dst.(*net.UDPAddr); ok {
+			return ipAddrs(0x02, src.IP, dst.IP, src.Port, dst.Port)
+		}
+	case *net.UnixAddr:
+		if dst, ok := dst.(*net.UnixAddr); ok {
+			addrs := make([]byte, 216)
+			copy(addrs[:108], src.Name)
+			copy(addrs[108:], dst.Name)
+			return 0x31, addrs
+		}
+	}
+	return 0, nil
+}
+
+func appendV2IPAddresses(src, dst net.IP, srcPort, dstPort int) []byte {
+	addrs := make([]byte, len(src)*2+4)
+	copy(addrs, src)
+	copy(addrs[len(src):], dst)
+	binary.BigEndian.PutUint16(addrs[len(src)*2:], uint16(srcPort))
+	binary.BigEndian.PutUint16(addrs[len(src)*2+2:], uint16(dstPort))
+	return addrs
+}
+
+// readProxyHeader reads the PROXY protocol header from the conn without reading the data
+// after the header. If the conn has no header, errNoProxyHeader and the bytes read are
+// returned.
+func readProxyHeader(conn io.Reader) (*ProxyHeader, []byte, error) {
+	// read until the bytes do not match the prefix of both versions, so the connections
+	// without header are not blocked
+	prefix := make([]byte, 0, len(proxyProtocolV2Signature))
+	for len(prefix) < cap(prefix) {
+		n, err := conn.Read(prefix[len(prefix):cap(prefix)])
+		prefix = prefix[:len(prefix)+n]
+		if !isProxyHeaderPrefix(prefix) {
+			return nil, prefix, errNoProxyHeader
+		}
+		if len(prefix) == 0 && errors.Is(err, os.ErrDeadlineExceeded) {
+			// the client of the server-speaks-first protocols sends nothing
+			return nil, prefix, errNoProxyHeader
+		}
+		if err != nil {
+			return nil, prefix, err
+		}
+	}
+
+	if bytes.Equal(prefix, proxyProtocolV2Signature) {
+		h, err := readProxyHeaderV2(conn)
+		return h, nil, err
+	}
+	h, err := readProxyHeaderV1(conn, prefix)
+	return h, nil, err
+}
+
+func isProxyHeaderPrefix(data []byte) bool {
+	if bytes.HasPrefix(proxyProtocolV2Signature, data) {
+		return true
+	}
+	if len(data) <= len(proxyProtocolV1Prefix) {
+		return strings.HasPrefix(proxyProtocolV1Prefix, string(data))
+	}
+	return strings.HasPrefix(string(data), proxyProtocolV1Prefix)
+}
+
+func readProxyHeaderV1(conn io.Reader, prefix []byte) (*ProxyHeader, error) {
+	line := append(make([]byte, 0, proxyProtocolV1MaxLength), prefix...)
+	b := make([]byte, 1)
+	for !bytes.HasSuffix(line, []byte("\r\n")) {
+		if len(line) >= proxyProtocolV1MaxLength {
+			return nil, errInvalidProxyHeader
+		}
+		if _, err := io.ReadFull(conn, b); err != nil {
+			return nil, err
+		}
+		line = append(line, b[0])
+	}
+
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	h := &ProxyHeader{Version: 1}
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		h.Local = true
+		return h, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, errInvalidProxyHeader
+	}
+
+	src, err := parseV1Address(fields[2], fields[4], fields[1] == "TCP4")
+	if err != nil {
+		return nil, err
+	}
+	dst, err := parseV1Address(fields[3], fields[5], fields[1] == "TCP4")
+	if err != nil {
+		return nil, err
+	}
+	h.SourceAddr = src
+	h.DestinationAddr = dst
+	return h, nil
+}
+
+func parseV1Address(ip, port string, v4 bool) (*net.TCPAddr, error) {
+	addr := &net.TCPAddr{IP: net.ParseIP(ip)}
+	if addr.IP == nil || (addr.IP.To4() != nil) != v4 {
+		return nil, errInvalidProxyHeader
+	}
+	v, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, errInvalidProxyHeader
+	}
+	addr.Port = int(v)
+	return addr, nil
+}
+
+func readProxyHeaderV2(conn io.Reader) (*ProxyHeader, error) {
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(conn, head); err != nil {
+		return nil, err
+	}
+	if head[0]>>4 != 2 {
+		return nil, errInvalidProxyHeader
+	}
+	h := &ProxyHeader{Version: 2}
+	switch head[0] & 0x0f {
+	case 0x00:
+		h.Local = true
+	case 0x01:
+	default:
+		return nil, errInvalidProxyHeader
+	}
+
+	payload := make([]byte, binary.BigEndian.Uint16(head[2:]))
+	if _, err := io.ReadFull(conn, payload); err != nil {
+		return nil, err
+	}
+
+	size := 0
+	switch head[1] >> 4 {
+	case 0x00:
+	case 0x01:
+		size = 12
+	case 0x02:
+		size = 36
+	case 0x03:
+		size = 216
+	default:
+		return nil, errInvalidProxyHeader
+	}
+	if len(payload) < size {
+		return nil, errInvalidProxyHeader
+	}
+	if !h.Local && size > 0 {
+		src, dst, err := parseV2Addresses(head[1], payload[:size])
+		if err != nil {
+			return nil, err
+		}
+		h.SourceAddr, h.DestinationAddr = src, dst
+	}
+
+	tlvs := payload[size:]
+	for len(tlvs) > 0 {
+		if len(tlvs) < 3 {
+			return nil, errInvalidProxyHeader
+		}
+		n := int(binary.BigEndian.Uint16(tlvs[1:3]))
+		if len(tlvs) < 3+n {
+			return nil, errInvalidProxyHeader
+		}
+		h.TLVs = append(h.TLVs, ProxyTLV{Type: tlvs[0], Value: tlvs[3 : 3+n]})
+		tlvs = tlvs[3+n:]
+	}
+	return h, nil
+}
+
+func parseV2Addresses(fam byte, addrs []byte) (net.Addr, net.Addr, error) {
+	proto := fam & 0x0f
+	if fam>>4 == 0x03 {
+		name := func(v []byte) string {
+			if idx := bytes.IndexByte(v, 0); idx >= 0 {
+				v = v[:idx]
+			}
+			return string(v)
+		}
+		network := "unix"
+		if proto == 0x02 {
+			network = "unixgram"
+		}
+		return &net.UnixAddr{Name: name(addrs[:108]), Net: network},
+			&net.UnixAddr{Name: name(addrs[108:]), Net: network}, nil
+	}
+
+	n := (len(addrs) - 4) / 2
+	srcIP := net.IP(append([]byte(nil), addrs[:n]...))
+	dstIP := net.IP(append([]byte(nil), addrs[n:2*n]...))
+	srcPort := int(binary.BigEndian.Uint16(addrs[2*n:]))
+	dstPort := int(binary.BigEndian.Uint16(addrs[2*n+2:]))
+	switch proto {
+	case 0x01:
+		return &net.TCPAddr{IP: srcIP, Port: srcPort}, &net.TCPAddr{IP: dstIP, Port: dstPort}, nil
+	case 0x02:
+		return &net.UDPAddr{IP: srcIP, Port: srcPort}, &net.UDPAddr{IP: dstIP, Port: dstPort}, nil
+	}
+	return nil, nil, errInvalidProxyHeader
+}
+
+// proxyProtocolConn is the conn accepted with the PROXY protocol header
+type proxyProtocolConn struct {
+	net.Conn
+	header *ProxyHeader
+	// buffered the bytes read while detecting the header of the conn without header
+	buffered []byte
+}
+
+func (c *proxyProtocolConn) Read(b []byte) (int, error) {
+	if len(c.buffered) > 0 {
+		n := copy(b, c.buffered)
+		c.buffered = c.buffered[n:]
+		return n, nil
+	}
+	return c.Conn.Read(b)
+}
+
+func (c *proxyProtocolConn) RemoteAddr() net.Addr {
+	if c.header != nil && c.header.SourceAddr != nil {
+		return c.header.SourceAddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+func (c *proxyProtocolConn) LocalAddr() net.Addr {
+	if c.header != nil && c.header.DestinationAddr != nil {
+		return c.header.DestinationAddr
+	}
+	return c.Conn.LocalAddr()
+}
+
+// CloseWrite closes the write side of the underlying conn, so the half-close of the conn
+// accepted with the PROXY protocol header works as the raw conn.
+func (c *proxyProtocolConn) CloseWrite() error {
+	cw, ok := c.Conn.(interface{ CloseWrite() error })
+	if !ok {
+		return errors.New("close write is not supported")
+	}
+	return cw.CloseWrite()
+}
+
+// SyscallConn returns the syscall.RawConn of the underlying conn, so the conn can be driven
+// by the event loop, it is not supported if any bytes buffered.
+func (c *proxyProtocolConn) SyscallConn() (syscall.RawConn, error) {
+	sc, ok := c.Conn.(syscall.Conn)
+	if !ok || len(c.buffered) > 0 {
+		return nil, errors.New("syscall conn is not supported")
+	}
+	return sc.SyscallConn()
+}
+
+// proxyProtocolListener reads the PROXY protocol headers of the accepted conns concurrently,
+// so the slow clients do not block the accept loop.
+type proxyProtocolListener struct {
+	net.Listener
+	cfg       ProxyProtocolConfig
+	logger    *zap.Logger
+	connC     chan net.Conn
+	errC      chan error
+	stopC     chan struct{}
+	startOnce sync.Once
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+
+	mu struct {
+		sync.Mutex
+		// pending the conns reading the header, closed if the listener closed
+		pending map[net.Conn]struct{}
+	}
+}
+
+func newProxyProtocolListener(l net.Listener, cfg ProxyProtocolConfig, logger *zap.Logger) *proxyProtocolListener {
+	if cfg.HeaderTimeout <= 0 {
+		cfg.HeaderTimeout = defaultProxyHeaderTimeout
+	}
+	pl := &proxyProtocolListener{
+		Listener: l,
+		cfg:      cfg,
+		logger:   logger,
+		connC:    make(chan net.Conn),
+		errC:     make(chan error),
+		stopC:    make(chan struct{}),
+	}
+	pl.mu.pending = make(map[net.Conn]struct{})
+	return pl
+}
+
+func (l *proxyProtocolListener) Accept() (net.Conn, error) {
+	l.startOnce.Do(func() {
+		l.wg.Add(1)
+		go l.acceptLoop()
+	})
+
+	select {
+	case conn := <-l.connC:
+		return conn, nil
+	case err := <-l.errC:
+		return nil, err
+	case <-l.stopC:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *proxyProtocolListener) Close() error {
+	err := net.ErrClosed
+	l.closeOnce.Do(func() {
+		close(l.stopC)
+		err = l.Listener.Close()
+		l.mu.Lock()
+		for conn := range l.mu.pending {
+			conn.Close()
+		}
+		l.mu.Unlock()
+		l.wg.Wait()
+	})
+	return err
+}
+
+func (l *proxyProtocolListener) acceptLoop() {
+	defer l.wg.Done()
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			select {
+			case l.errC <- err:
+			case <-l.stopC:
+				return
+			}
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				continue
+			}
+			return
+		}
+
+		l.mu.Lock()
+		select {
+		case <-l.stopC:
+			l.mu.Unlock()
+			conn.Close()
+			return
+		default:
+		}
+		l.mu.pending[conn] = struct{}{}
+		l.mu.Unlock()
+
+		l.wg.Add(1)
+		go l.handshake(conn)
+	}
+}
+
+// handshake reads the header of the conn, and hands off the conn to Accept
+func (l *proxyProtocolListener) handshake(conn net.Conn) {
+	defer l.wg.Done()
+
+	wrapped, err := l.readHeader(conn)
+	l.mu.Lock()
+	delete(l.mu.pending, conn)
+	l.mu.Unlock()
+	if err != nil {
+		l.logger.Info("read proxy protocol header failed",
+			zap.String("addr", conn.RemoteAddr().String()),
+			zap.Error(err))
+		conn.Close()
+		return
+	}
+
+	select {
+	case l.connC <- wrapped:
+	case <-l.stopC:
+		conn.Close()
+	}
+}
+
+func (l *proxyProtocolListener) readHeader(conn net.Conn) (net.Conn, error) {
+	if err := conn.SetReadDeadline(time.Now().Add(l.cfg.HeaderTimeout)); err != nil {
+		return nil, err
+	}
+	header, buffered, err := readProxyHeader(conn)
+	if err == errNoProxyHeader && l.cfg.AllowNoHeader {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.SetReadDeadline(time.Time{}); err != nil {
+		return nil, err
+	}
+	return &proxyProtocolConn{Conn: conn, header: header, buffered: buffered}, nil
+}
@@ -0,0 +1,233 @@
+package goetty
+
+import (
+	"bytes"
+	"crypto/tls"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/lni/goutils/leaktest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProxyHeaderWriteAndRead(t *testing.T) {
+	tcp4Src := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1000}
+	tcp4Dst := &net.TCPAddr{IP: net.ParseIP("10.0.0.2"), Port: 80}
+	tcp6Src := &net.TCPAddr{IP: net.ParseIP("fd00::1"), Port: 1000}
+	tcp6Dst := &net.TCPAddr{IP: net.ParseIP("fd00::2"), Port: 80}
+	tlvs := []ProxyTLV{
+		{Type: ProxyTLVTypeAuthority, Value: []byte("example.com")},
+		{Type: ProxyTLVTypeUniqueID, Value: []byte{1, 2, 3}},
+	}
+
+	cases := map[string]struct {
+		header *ProxyHeader
+		local  bool
+		tlvs   []ProxyTLV
+	}{
+		"v1-tcp4": {header: &ProxyHeader{Version: 1, SourceAddr: tcp4Src, DestinationAddr: tcp4Dst}},
+		"v1-tcp6": {header: &ProxyHeader{Version: 1, SourceAddr: tcp6Src, DestinationAddr: tcp6Dst}},
+		"v1-unknown": {
+			header: &ProxyHeader{Version: 1, SourceAddr: &net.UnixAddr{Name: "a"}, DestinationAddr: &net.UnixAddr{Name: "b"}},
+			local:  true,
+		},
+		"v2-tcp4": {header: &ProxyHeader{Version: 2, SourceAddr: tcp4Src, DestinationAddr: tcp4Dst, TLVs: tlvs}, tlvs: tlvs},
+		"v2-tcp6": {header: &ProxyHeader{Version: 2, SourceAddr: tcp6Src, DestinationAddr: tcp6Dst}},
+		"v2-udp4": {header: &ProxyHeader{
+			Version:         2,
+			SourceAddr:      &net.UDPAddr{IP: net.ParseIP("10.0.0.1"), Port: 53},
+			DestinationAddr: &net.UDPAddr{IP: net.ParseIP("10.0.0.2"), Port: 53},
+		}},
+		"v2-unix": {header: &ProxyHeader{
+			Version:         2,
+			SourceAddr:      &net.UnixAddr{Name: "/tmp/client.sock", Net: "unix"},
+			DestinationAddr: &net.UnixAddr{Name: "/tmp/server.sock", Net: "unix"},
+		}},
+		"v2-local": {header: &ProxyHeader{Version: 2, Local: true, TLVs: tlvs}, local: true, tlvs: tlvs},
+	}
+	for name, c := range cases {
+		tc := c
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			n, err := tc.header.WriteTo(&buf)
+			assert.NoError(t, err)
+			assert.Equal(t, int64(buf.Len()), n)
+			buf.WriteString("data")
+
+			header, buffered, err := readProxyHeader(&buf)
+			assert.NoError(t, err)
+			assert.Empty(t, buffered)
+			assert.Equal(t, "data", buf.String())
+			assert.Equal(t, tc.header.Version, header.Version)
+			assert.Equal(t, tc.local, header.Local)
+			assert.Equal(t, tc.tlvs, header.TLVs)
+			if !tc.local {
+				assert.Equal(t, tc.header.SourceAddr.String(), header.SourceAddr.String())
+				assert.Equal(t, tc.header.DestinationAddr.String(), header.DestinationAddr.String())
+			}
+		})
+	}
+
+	_, err := (&ProxyHeader{Version: 3}).WriteTo(&bytes.Buffer{})
+	assert.Error(t, err)
+}
+
+func TestReadProxyHeaderFailed(t *testing.T) {
+	header, buffered, err := readProxyHeader(bytes.NewBufferString("hello"))
+	assert.Nil(t, header)
+	assert.Equal(t, errNoProxyHeader, err)
+	assert.Equal(t, []byte("hello"), buffered)
+
+	header, buffered, err = readProxyHeader(bytes.NewBufferString("PROXY-hello world"))
+	assert.Nil(t, header)
+	assert.Equal(t, errNoProxyHeader, err)
+	assert.Equal(t, []byte("PROXY-hello "), buffered)
+
+	for _, data := range []string{
+		"PROXY TCP4 10.0.0.1 10.0.0.2 1000\r\n",
+		"PROXY TCP4 fd00::1 fd00::2 1000 80\r\n",
+		"PROXY TCP4 10.0.0.1 10.0.0.2 1000 65536\r\n",
+		"PROXY UDP4 10.0.0.1 10.0.0.2 1000 80\r\n",
+		"PROXY TCP4 " + string(bytes.Repeat([]byte("1"), proxyProtocolV1MaxLength)),
+		string(proxyProtocolV2Signature) + "\x11\x11\x00\x01\x00",
+		string(proxyProtocolV2Signature) + "\x21\x11\x00\x04\x00\x00\x00\x00",
+		string(proxyProtocolV2Signature) + "\x21\x00\x00\x02\x01\x00",
+	} {
+		_, _, err := readProxyHeader(bytes.NewBufferString(data))
+		assert.Error(t, err, data)
+		assert.NotEqual(t, errNoProxyHeader, err, data)
+	}
+}
+
+func TestProxyHeaderOf(t *testing.T) {
+	header := &ProxyHeader{Version: 2, Local: true}
+	conn := &proxyProtocolConn{header: header}
+	v, ok := ProxyHeaderOf(conn)
+	assert.True(t, ok)
+	assert.Equal(t, header, v)
+
+	v, ok = ProxyHeaderOf(tls.Server(conn, &tls.Config{}))
+	assert.True(t, ok)
+	assert.Equal(t, header, v)
+
+	_, ok = ProxyHeaderOf(&proxyProtocolConn{})
+	assert.False(t, ok)
+}
+
+func TestAppProxyProtocol(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	for name, opts := range map[string][]AppOption[string, string]{
+		"default":    nil,
+		"event-loop": {WithAppEventLoop[string, string](1)},
+	} {
+		appOpts := opts
+		t.Run(name, func(t *testing.T) {
+			app := newTestApp(t,
+				testListenAddresses,
+				func(rs IOSession[string, string], msg string, received uint64) error {
+					return rs.Write(rs.RemoteAddress(), WriteOptions{Flush: true})
+				},
+				append(appOpts, WithAppProxyProtocol[string, string](ProxyProtocolConfig{
+					HeaderTimeout: time.Millisecond * 100,
+				}))...)
+			assert.NoError(t, app.Start())
+			defer app.Stop()
+
+			for _, address := range testAddresses {
+				for version := 1; version <= 2; version++ {
+					rs := newTestIOSession(t)
+					assert.NoError(t, rs.Connect(address, time.Second))
+					_, err := (&ProxyHeader{
+						Version:         version,
+						SourceAddr:      &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1000 + version},
+						DestinationAddr: &net.TCPAddr{IP: net.ParseIP("10.0.0.2"), Port: 80},
+					}).WriteTo(rs.RawConn())
+					assert.NoError(t, err)
+					assert.NoError(t, rs.Write("hello", WriteOptions{Flush: true}))
+					reply, err := rs.Read(ReadOptions{Timeout: time.Second})
+					assert.NoError(t, err)
+					assert.Equal(t, (&net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1000 + version}).String(), reply)
+					assert.NoError(t, rs.Close())
+				}
+
+				// the conns without header or timeout are closed
+				for _, data := range []string{"hello", ""} {
+					rs := newTestIOSession(t)
+					assert.NoError(t, rs.Connect(address, time.Second))
+					if data != "" {
+						assert.NoError(t, rs.Write(data, WriteOptions{Flush: true}))
+					}
+					_, err := rs.Read(ReadOptions{Timeout: time.Second})
+					assert.Error(t, err)
+					assert.False(t, isTimeoutErr(err))
+					assert.NoError(t, rs.Close())
+				}
+			}
+		})
+	}
+}
+
+func TestAppProxyProtocolAllowNoHeader(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	app := newTestApp(t,
+		[]string{testUnixSocket},
+		func(rs IOSession[string, string], msg string, received uint64) error {
+			return rs.Write(msg, WriteOptions{Flush: true})
+		},
+		WithAppProxyProtocol[string, string](ProxyProtocolConfig{
+			HeaderTimeout: time.Millisecond * 50,
+			AllowNoHeader: true,
+		}))
+	assert.NoError(t, app.Start())
+	defer app.Stop()
+
+	rs := newTestIOSession(t)
+	defer rs.Close()
+	assert.NoError(t, rs.Connect(testUnixSocket, time.Second))
+	assertTestEcho(t, rs)
+
+	// the session is created after the header timeout if the client sends nothing
+	rs2 := newTestIOSession(t)
+	defer rs2.Close()
+	assert.NoError(t, rs2.Connect(testUnixSocket, time.Second))
+	assert.Eventually(t, func() bool {
+		return app.Count() == 2
+	}, time.Second, time.Millisecond*10)
+	assertTestEcho(t, rs2)
+}
+
+func TestProxyWithProxyProtocol(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	upstream := newTestApp(t, []string{upstream1Address},
+		func(rs IOSession[string, string], msg string, received uint64) error {
+			header, ok := ProxyHeaderOf(rs.RawConn())
+			assert.True(t, ok)
+			authority, _ := header.TLV(ProxyTLVTypeAuthority)
+			return rs.Write(rs.RemoteAddress()+"/"+string(authority), WriteOptions{Flush: true})
+		},
+		WithAppProxyProtocol[string, string](ProxyProtocolConfig{}))
+	assert.NoError(t, upstream.Start())
+	defer upstream.Stop()
+
+	proxy := newTestProxy(t, nil,
+		WithProxyAcceptProxyProtocol(ProxyProtocolConfig{}),
+		WithProxyProtocolHeader(2))
+	defer proxy.Stop()
+	proxy.AddUpStream(upstream1Address, time.Second)
+
+	rs := newTestIOSession(t)
+	defer rs.Close()
+	assert.NoError(t, rs.Connect(proxyAddress, time.Second))
+	_, err := (&ProxyHeader{
+		Version:         2,
+		SourceAddr:      &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1000},
+		DestinationAddr: &net.TCPAddr{IP: net.ParseIP("10.0.0.2"), Port: 80},
+		TLVs:            []ProxyTLV{{Type: ProxyTLVTypeAuthority, Value: []byte("example.com")}},
+	}).WriteTo(rs.RawConn())
+	assert.NoError(t, err)
+	assertTestProxyReply(t, rs, "10.0.0.1:1000/example.com")
+}
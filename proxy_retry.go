@@ -0,0 +1,94 @@
+package goetty
+
+import (
+	"time"
+)
+
+// ProxyRetryConfig the config to retry dialing the next upstreams if failed to dial the
+// upstream for a client connection
+type ProxyRetryConfig struct {
+	// MaxAttempts max number of the upstreams to dial for a client connection, each upstream
+	// is dialed at most once. Default is 1, no retry.
+	MaxAttempts int
+	// Budget total time to dial the upstreams for a client connection, the connect timeout of
+	// each attempt is limited by the remaining budget. 0 means no limit.
+	Budget time.Duration
+}
+
+// CircuitBreakerConfig the config of the circuit breaker of each upstream. The circuit is
+// opened after consecutive dial failures, and the upstream is skipped in the cool down. After
+// the cool down, the circuit is half-opened to allow one connection to try the upstream, it
+// is closed if the dial succeeded, otherwise opened again.
+type CircuitBreakerConfig struct {
+	// FailureThreshold number of consecutive dial failures to open the circuit, default is 5
+	FailureThreshold int
+	// CoolDown time to keep the circuit open, default is 10s
+	CoolDown time.Duration
+}
+
+// WithProxyRetry set the retry config of dialing the upstreams
+func WithProxyRetry(cfg ProxyRetryConfig) ProxyOption {
+	return func(opts *proxyOptions) {
+		opts.retry = cfg
+	}
+}
+
+// WithProxyCircuitBreaker enable the circuit breaker of each upstream
+func WithProxyCircuitBreaker(cfg CircuitBreakerConfig) ProxyOption {
+	return func(opts *proxyOptions) {
+		if cfg.FailureThreshold <= 0 {
+			cfg.FailureThreshold = defaultCircuitBreakerFailureThreshold
+		}
+		if cfg.CoolDown <= 0 {
+			cfg.CoolDown = defaultCircuitBreakerCoolDown
+		}
+		opts.circuitBreaker = &cfg
+	}
+}
+
+// circuitBreaker the circuit breaker state of an upstream, protected by the lock of the proxy
+type circuitBreaker struct {
+	failures int
+	// openUntil the circuit is open until the time, zero if closed
+	openUntil time.Time
+	// trying a connection is trying the upstream in the half-open state
+	trying bool
+}
+
+// allow returns true if the upstream can be selected
+func (cb *circuitBreaker) allow(now time.Time) bool {
+	if cb.openUntil.IsZero() {
+		return true
+	}
+	return !now.Before(cb.openUntil) && !cb.trying
+}
+
+// onSelected marks the connection trying the upstream if the circuit is half-open
+func (cb *circuitBreaker) onSelected() {
+	if !cb.openUntil.IsZero() {
+		cb.trying = true
+	}
+}
+
+// onDial updates the circuit by the dial result, returns true if the circuit is opened
+func (cb *circuitBreaker) onDial(ok bool, now time.Time, cfg *CircuitBreakerConfig) bool {
+	if ok {
+		cb.failures = 0
+		cb.openUntil = time.Time{}
+		cb.trying = false
+		return false
+	}
+
+	cb.failures++
+	if cb.trying || cb.failures >= cfg.FailureThreshold {
+		cb.openUntil = now.Add(cfg.CoolDown)
+		cb.trying = false
+		return true
+	}
+	return false
+}
+
+// isOpen returns true if the circuit is open or half-open
+func (cb *circuitBreaker) isOpen() bool {
+	return !cb.openUntil.IsZero()
+}
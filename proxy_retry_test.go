@@ -0,0 +1,101 @@
+package goetty
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/lni/goutils/leaktest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProxyRetry(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	assert.NoError(t, os.RemoveAll(upstream2Address[7:]))
+	proxy := newTestProxy(t, nil, WithProxyRetry(ProxyRetryConfig{MaxAttempts: 2, Budget: time.Second}))
+	defer func() {
+		assert.NoError(t, proxy.Stop())
+	}()
+	upstream1 := newTestUpstream(t, upstream1Address, "upstream1")
+	defer func() {
+		assert.NoError(t, upstream1.Stop())
+	}()
+	proxy.AddUpStream(upstream2Address, time.Second)
+	proxy.AddUpStream(upstream1Address, time.Second)
+
+	for i := 0; i < 4; i++ {
+		assert.Equal(t, "upstream1", mustProxyRequest(t))
+	}
+	assert.Eventually(t, func() bool {
+		for _, stats := range proxy.UpStreams() {
+			if stats.ActiveConns != 0 {
+				return false
+			}
+		}
+		return true
+	}, time.Second, time.Millisecond*10)
+}
+
+func TestProxyCircuitBreaker(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	assert.NoError(t, os.RemoveAll(upstream2Address[7:]))
+	proxy := newTestProxy(t, nil,
+		WithProxyRetry(ProxyRetryConfig{MaxAttempts: 2}),
+		WithProxyCircuitBreaker(CircuitBreakerConfig{
+			FailureThreshold: 1,
+			CoolDown:         time.Millisecond * 100,
+		}))
+	defer func() {
+		assert.NoError(t, proxy.Stop())
+	}()
+	upstream1 := newTestUpstream(t, upstream1Address, "upstream1")
+	defer func() {
+		assert.NoError(t, upstream1.Stop())
+	}()
+	proxy.AddUpStream(upstream2Address, time.Second)
+	proxy.AddUpStream(upstream1Address, time.Second)
+
+	assert.Equal(t, "upstream1", mustProxyRequest(t))
+	stats := proxy.UpStreams()
+	assert.True(t, stats[0].CircuitOpen)
+	assert.False(t, stats[1].CircuitOpen)
+
+	// the upstream is tried again after the cool down
+	upstream2 := newTestUpstream(t, upstream2Address, "upstream2")
+	defer func() {
+		assert.NoError(t, upstream2.Stop())
+	}()
+	assert.Eventually(t, func() bool {
+		return mustProxyRequest(t) == "upstream2"
+	}, time.Second*5, time.Millisecond*20)
+	assert.False(t, proxy.UpStreams()[0].CircuitOpen)
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	cfg := &CircuitBreakerConfig{FailureThreshold: 2, CoolDown: time.Second}
+	now := time.Now()
+	var cb circuitBreaker
+	assert.True(t, cb.allow(now))
+	assert.False(t, cb.onDial(false, now, cfg))
+	assert.True(t, cb.allow(now))
+	assert.True(t, cb.onDial(false, now, cfg))
+	assert.False(t, cb.allow(now))
+	assert.True(t, cb.isOpen())
+
+	// half-open allows only one trial
+	now = now.Add(time.Second)
+	assert.True(t, cb.allow(now))
+	cb.onSelected()
+	assert.False(t, cb.allow(now))
+	assert.True(t, cb.onDial(false, now, cfg))
+	assert.False(t, cb.allow(now))
+
+	now = now.Add(time.Second)
+	assert.True(t, cb.allow(now))
+	cb.onSelected()
+	assert.False(t, cb.onDial(true, now, cfg))
+	assert.True(t, cb.allow(now))
+	assert.False(t, cb.isOpen())
+}
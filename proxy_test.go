@@ -1,10 +1,17 @@
 package goetty
 
 import (
+	"bytes"
+	"context"
+	"io"
+	"net"
 	"os"
 	"testing"
 	"time"
 
+	"github.com/fagongzi/goetty/v3/buf"
+	"github.com/fagongzi/goetty/v3/codec/simple"
+	"github.com/lni/goutils/leaktest"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -66,3 +73,403 @@ func TestProxy(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, "upstream2", v)
 }
+
+func TestProxyHalfClose(t *testing.T) {
+	cases := map[string]struct {
+		proxyAddress    string
+		upstreamAddress string
+		proxyProtocol   bool
+	}{
+		"unix": {proxyAddress: proxyAddress, upstreamAddress: upstream1Address},
+		// the tcp conns are copied by the splice
+		"tcp":                {proxyAddress: "127.0.0.1:12346", upstreamAddress: "127.0.0.1:12347"},
+		"tcp-proxy-protocol": {proxyAddress: "127.0.0.1:12346", upstreamAddress: "127.0.0.1:12347", proxyProtocol: true},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			testProxyHalfClose(t, c.proxyAddress, c.upstreamAddress, c.proxyProtocol)
+		})
+	}
+}
+
+func testProxyHalfClose(t *testing.T, proxyAddress, upstreamAddress string, proxyProtocol bool) {
+	defer leaktest.AfterTest(t)()
+
+	proxyNetwork, proxyAddr, err := parseAddress(proxyAddress)
+	assert.NoError(t, err)
+	upstreamNetwork, upstreamAddr, err := parseAddress(upstreamAddress)
+	assert.NoError(t, err)
+	if proxyNetwork == "unix" {
+		assert.NoError(t, os.RemoveAll(proxyAddr))
+	}
+	if upstreamNetwork == "unix" {
+		assert.NoError(t, os.RemoveAll(upstreamAddr))
+	}
+
+	statsC := make(chan ProxyConnStats, 1)
+	opts := []ProxyOption{WithProxyConnClosed(func(stats ProxyConnStats) {
+		statsC <- stats
+	})}
+	if proxyProtocol {
+		opts = append(opts, WithProxyAcceptProxyProtocol(ProxyProtocolConfig{}))
+	}
+	proxy := NewProxy[string, string](proxyAddress, nil, opts...)
+	assert.NoError(t, proxy.Start())
+	defer func() {
+		assert.NoError(t, proxy.Stop())
+	}()
+
+	// the upstream closes write after the greeting, and then reads until the client closed write
+	greeting := []byte("hello")
+	receivedC := make(chan int, 1)
+	l, err := net.Listen(upstreamNetwork, upstreamAddr)
+	assert.NoError(t, err)
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, err = conn.Write(greeting)
+		assert.NoError(t, err)
+		assert.NoError(t, conn.(interface{ CloseWrite() error }).CloseWrite())
+		data, err := io.ReadAll(conn)
+		assert.NoError(t, err)
+		receivedC <- len(data)
+	}()
+	proxy.AddUpStream(upstreamAddress, time.Second)
+
+	conn, err := net.Dial(proxyNetwork, proxyAddr)
+	assert.NoError(t, err)
+	defer conn.Close()
+	assert.NoError(t, conn.SetDeadline(time.Now().Add(time.Second*5)))
+	if proxyProtocol {
+		_, err = (&ProxyHeader{
+			Version:         2,
+			SourceAddr:      &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1000},
+			DestinationAddr: &net.TCPAddr{IP: net.ParseIP("10.0.0.2"), Port: 80},
+		}).WriteTo(conn)
+		assert.NoError(t, err)
+	}
+	// the proxy closes write to the client after the upstream closed write, the client still writes
+	reply, err := io.ReadAll(conn)
+	assert.NoError(t, err)
+	assert.Equal(t, greeting, reply)
+
+	data := bytes.Repeat([]byte("x"), defaultProxyCopyChunkSize*3)
+	_, err = conn.Write(data)
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		conns := proxy.Connections()
+		return len(conns) == 1 && conns[0].ClientBytes == int64(len(data))
+	}, time.Second*5, time.Millisecond*10)
+	assert.NoError(t, conn.(interface{ CloseWrite() error }).CloseWrite())
+	assert.Equal(t, len(data), <-receivedC)
+
+	stats := <-statsC
+	assert.Equal(t, int64(len(data)), stats.ClientBytes)
+	assert.Equal(t, int64(len(reply)), stats.UpstreamBytes)
+	assert.Equal(t, upstreamAddress, stats.UpstreamAddress)
+	assert.Empty(t, proxy.Connections())
+	upstreams := proxy.UpStreams()
+	assert.Equal(t, 1, len(upstreams))
+	assert.Equal(t, int64(len(data)), upstreams[0].ClientBytes)
+	assert.Equal(t, int64(len(reply)), upstreams[0].UpstreamBytes)
+}
+
+func TestCopyAndCloseWriteWithBufferedBytes(t *testing.T) {
+	src, srcPeer := net.Pipe()
+	dst, dstPeer := net.Pipe()
+	defer dstPeer.Close()
+
+	buffered := buf.NewByteBuf(16)
+	buffered.WriteString("hello")
+	go func() {
+		defer srcPeer.Close()
+		_, err := srcPeer.Write([]byte(" world"))
+		assert.NoError(t, err)
+	}()
+
+	var counter int64
+	errC := make(chan error, 1)
+	go func() {
+		errC <- copyAndCloseWrite(dst, src, buffered, &counter)
+		dst.Close()
+	}()
+	data, err := io.ReadAll(dstPeer)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello world", string(data))
+	assert.NoError(t, <-errC)
+	assert.Equal(t, int64(11), counter)
+	assert.Equal(t, 0, buffered.Readable())
+}
+
+func TestProxyRemoveAndSetUpStreams(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	proxy := newTestProxy(t, nil)
+	defer func() {
+		assert.NoError(t, proxy.Stop())
+	}()
+	upstream1 := newTestUpstream(t, upstream1Address, "upstream1")
+	defer func() {
+		assert.NoError(t, upstream1.Stop())
+	}()
+	upstream2 := newTestUpstream(t, upstream2Address, "upstream2")
+	defer func() {
+		assert.NoError(t, upstream2.Stop())
+	}()
+
+	proxy.SetUpStreams([]UpstreamConfig{
+		{Address: upstream1Address, ConnectTimeout: time.Second},
+		{Address: upstream2Address, ConnectTimeout: time.Second, Weight: 2},
+	})
+	stats := proxy.UpStreams()
+	assert.Equal(t, 2, len(stats))
+	assert.Equal(t, UpstreamStats{Address: upstream1Address, Weight: 1, Healthy: true}, stats[0])
+	assert.Equal(t, UpstreamStats{Address: upstream2Address, Weight: 2, Healthy: true}, stats[1])
+
+	assert.False(t, proxy.RemoveUpStream("unix:///tmp/not-found.sock"))
+	assert.True(t, proxy.RemoveUpStream(upstream2Address))
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, "upstream1", mustProxyRequest(t))
+	}
+	assert.Eventually(t, func() bool {
+		stats := proxy.UpStreams()
+		return len(stats) == 1 && stats[0].ActiveConns == 0
+	}, time.Second, time.Millisecond*10)
+	stats = proxy.UpStreams()
+	assert.True(t, stats[0].ClientBytes > 0)
+	assert.True(t, stats[0].UpstreamBytes > 0)
+
+	// the counters of the existing upstream are kept
+	proxy.SetUpStreams([]UpstreamConfig{
+		{Address: upstream2Address, ConnectTimeout: time.Second},
+		{Address: upstream1Address, ConnectTimeout: time.Second},
+	})
+	newStats := proxy.UpStreams()
+	assert.Equal(t, upstream2Address, newStats[0].Address)
+	assert.Equal(t, stats[0], newStats[1])
+}
+
+func TestProxyDuplicateUpStreams(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	proxy := newTestProxy(t, nil)
+	defer func() {
+		assert.NoError(t, proxy.Stop())
+	}()
+	upstream1 := newTestUpstream(t, upstream1Address, "upstream1")
+	defer func() {
+		assert.NoError(t, upstream1.Stop())
+	}()
+
+	proxy.AddUpStream(upstream1Address, time.Second)
+	proxy.AddUpStream(upstream1Address, time.Second, WithUpstreamWeight(2))
+	assert.Equal(t, []UpstreamStats{{Address: upstream1Address, Weight: 2, Healthy: true}}, proxy.UpStreams())
+
+	proxy.SetUpStreams([]UpstreamConfig{
+		{Address: upstream2Address, ConnectTimeout: time.Second},
+		{Address: upstream2Address, ConnectTimeout: time.Second, Weight: 3},
+	})
+	assert.Equal(t, []UpstreamStats{{Address: upstream2Address, Weight: 3, Healthy: true}}, proxy.UpStreams())
+	assert.True(t, proxy.RemoveUpStream(upstream2Address))
+	assert.Empty(t, proxy.UpStreams())
+
+	// reconfigure the upstreams while dialing
+	proxy.AddUpStream(upstream1Address, time.Second)
+	stopC := make(chan struct{})
+	doneC := make(chan struct{})
+	go func() {
+		defer close(doneC)
+		for {
+			select {
+			case <-stopC:
+				return
+			default:
+				proxy.SetUpStreams([]UpstreamConfig{{Address: upstream1Address, ConnectTimeout: time.Second}})
+			}
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, "upstream1", mustProxyRequest(t))
+	}
+	close(stopC)
+	<-doneC
+}
+
+func TestProxyDrainUpStream(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	proxy := newTestProxy(t, nil)
+	defer func() {
+		assert.NoError(t, proxy.Stop())
+	}()
+	upstream1 := newTestUpstream(t, upstream1Address, "upstream1")
+	defer func() {
+		assert.NoError(t, upstream1.Stop())
+	}()
+	upstream2 := newTestUpstream(t, upstream2Address, "upstream2")
+	defer func() {
+		assert.NoError(t, upstream2.Stop())
+	}()
+	proxy.AddUpStream(upstream1Address, time.Second)
+	proxy.AddUpStream(upstream2Address, time.Second)
+
+	c1 := newTestIOSession(t)
+	defer c1.Close()
+	assert.NoError(t, c1.Connect(proxyAddress, time.Second))
+	assertTestProxyReply(t, c1, "upstream1")
+
+	errC := make(chan error, 1)
+	go func() {
+		errC <- proxy.DrainUpStream(context.Background(), upstream1Address)
+	}()
+	assert.Eventually(t, func() bool {
+		return proxy.UpStreams()[0].Draining
+	}, time.Second, time.Millisecond*10)
+	assert.Equal(t, 1, proxy.UpStreams()[0].ActiveConns)
+
+	// the new connections are not proxied to the draining upstream, and the existing one
+	// keeps working
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, "upstream2", mustProxyRequest(t))
+	}
+	assertTestProxyReply(t, c1, "upstream1")
+
+	assert.NoError(t, c1.Disconnect())
+	assert.NoError(t, <-errC)
+	stats := proxy.UpStreams()
+	assert.Equal(t, 1, len(stats))
+	assert.Equal(t, upstream2Address, stats[0].Address)
+	assert.Error(t, proxy.DrainUpStream(context.Background(), upstream1Address))
+}
+
+func TestProxyDrainUpStreamRedeclared(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	proxy := newTestProxy(t, nil)
+	defer func() {
+		assert.NoError(t, proxy.Stop())
+	}()
+	upstream1 := newTestUpstream(t, upstream1Address, "upstream1")
+	defer func() {
+		assert.NoError(t, upstream1.Stop())
+	}()
+
+	for name, redeclare := range map[string]func(){
+		"add": func() { proxy.AddUpStream(upstream1Address, time.Second) },
+		"set": func() {
+			proxy.SetUpStreams([]UpstreamConfig{{Address: upstream1Address, ConnectTimeout: time.Second}})
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			proxy.AddUpStream(upstream1Address, time.Second)
+			c1 := newTestIOSession(t)
+			defer c1.Close()
+			assert.NoError(t, c1.Connect(proxyAddress, time.Second))
+			assertTestProxyReply(t, c1, "upstream1")
+
+			errC := make(chan error, 1)
+			go func() {
+				errC <- proxy.DrainUpStream(context.Background(), upstream1Address)
+			}()
+			assert.Eventually(t, func() bool {
+				return proxy.UpStreams()[0].Draining
+			}, time.Second, time.Millisecond*10)
+
+			// the draining upstream is replaced, and not removed after drained
+			redeclare()
+			assert.False(t, proxy.UpStreams()[0].Draining)
+			assert.Equal(t, "upstream1", mustProxyRequest(t))
+			assert.NoError(t, c1.Disconnect())
+			assert.NoError(t, <-errC)
+			stats := proxy.UpStreams()
+			assert.Equal(t, 1, len(stats))
+			assert.False(t, stats[0].Draining)
+			assert.Equal(t, "upstream1", mustProxyRequest(t))
+		})
+	}
+}
+
+func TestProxyDrainUpStreamTimeout(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	proxy := newTestProxy(t, nil)
+	defer func() {
+		assert.NoError(t, proxy.Stop())
+	}()
+	upstream1 := newTestUpstream(t, upstream1Address, "upstream1")
+	defer func() {
+		assert.NoError(t, upstream1.Stop())
+	}()
+	proxy.AddUpStream(upstream1Address, time.Second)
+
+	c1 := newTestIOSession(t)
+	defer c1.Close()
+	assert.NoError(t, c1.Connect(proxyAddress, time.Second))
+	assertTestProxyReply(t, c1, "upstream1")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, proxy.DrainUpStream(ctx, upstream1Address))
+	_, err := c1.Read(ReadOptions{Timeout: time.Second})
+	assert.Error(t, err)
+	assert.False(t, isTimeoutErr(err))
+	assert.Empty(t, proxy.UpStreams())
+	assert.Eventually(t, func() bool {
+		return len(proxy.Connections()) == 0
+	}, time.Second, time.Millisecond*10)
+}
+
+func assertTestProxyReply(t *testing.T, rs IOSession[string, string], expect string) {
+	assert.NoError(t, rs.Write("test", WriteOptions{Flush: true}))
+	reply, err := rs.Read(ReadOptions{Timeout: time.Second})
+	assert.NoError(t, err)
+	assert.Equal(t, expect, reply)
+}
+
+// newTestProxy starts a proxy, the proxy forwards the messages routed by the cfg if cfg is
+// not nil, otherwise the bytes are forwarded.
+func newTestProxy(t *testing.T, cfg *MessageProxyConfig[string, string], opts ...ProxyOption) Proxy {
+	assert.NoError(t, os.RemoveAll(proxyAddress[7:]))
+	var proxy Proxy
+	if cfg != nil {
+		cfg.Codec = simple.NewStringCodec()
+		cfg.UpstreamCodec = simple.NewStringCodec()
+		proxy = NewMessageProxy(proxyAddress, nil, *cfg, opts...)
+	} else {
+		proxy = NewProxy[string, string](proxyAddress, nil, opts...)
+	}
+	assert.NoError(t, proxy.Start())
+	return proxy
+}
+
+// newTestUpstream starts an upstream replies all requests with the name
+func newTestUpstream(t *testing.T, address, name string) NetApplication[string, string] {
+	app := newTestApp(t, []string{address},
+		func(rs IOSession[string, string], msg string, received uint64) error {
+			return rs.Write(name, WriteOptions{Flush: true})
+		})
+	assert.NoError(t, app.Start())
+	return app
+}
+
+func proxyRequest(t *testing.T) (string, error) {
+	rs := newTestIOSession(t)
+	defer rs.Close()
+	if err := rs.Connect(proxyAddress, time.Second); err != nil {
+		return "", err
+	}
+	if err := rs.Write("test", WriteOptions{Flush: true}); err != nil {
+		return "", err
+	}
+	return rs.Read(ReadOptions{Timeout: time.Second})
+}
+
+func mustProxyRequest(t *testing.T) string {
+	reply, err := proxyRequest(t)
+	assert.NoError(t, err)
+	return reply
+}
@@ -0,0 +1,254 @@
+package goetty
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// SessionState state of IOSession
+type SessionState int
+
+const (
+	// SessionConnecting the IOSession is connecting to the remote address
+	SessionConnecting SessionState = iota
+	// SessionConnected the IOSession is connected
+	SessionConnected
+	// SessionDisconnected the IOSession is disconnected, and can be connected again
+	SessionDisconnected
+	// SessionClosed the IOSession is closed
+	SessionClosed
+)
+
+// String returns the name of the session state
+func (s SessionState) String() string {
+	switch s {
+	case SessionConnecting:
+		return "connecting"
+	case SessionConnected:
+		return "connected"
+	case SessionDisconnected:
+		return "disconnected"
+	case SessionClosed:
+		return "closed"
+	}
+	return "unknown"
+}
+
+// ReconnectPolicy auto reconnect policy for client IOSession. The zero value is valid and
+// uses the default values.
+type ReconnectPolicy struct {
+	// InitialBackoff backoff before the second attempt, the first attempt is made immediately.
+	// Default is 100ms.
+	InitialBackoff time.Duration
+	// MaxBackoff max backoff between two attempts. Default is 30s.
+	MaxBackoff time.Duration
+	// Multiplier factor to multiply the backoff after each failed attempt. Default is 2.
+	Multiplier float64
+	// Jitter randomizes the backoff in range [backoff*(1-Jitter), backoff*(1+Jitter)], should
+	// be in range [0, 1].
+	Jitter float64
+	// MaxAttempts max attempts for one reconnection, 0 means no limit.
+	MaxAttempts int
+	// ConnectTimeout timeout for each attempt, default is the timeout used by Connect.
+	ConnectTimeout time.Duration
+	// WaitOnWrite if true, Write blocks until the IOSession reconnected, the reconnection
+	// gave up, or the WriteOptions.Timeout reached. Otherwise Write returns ErrIllegalState
+	// while reconnecting.
+	WaitOnWrite bool
+}
+
+func (p *ReconnectPolicy) adjust() {
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = defaultReconnectInitialBackoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = defaultReconnectMaxBackoff
+	}
+	if p.MaxBackoff < p.InitialBackoff {
+		p.MaxBackoff = p.InitialBackoff
+	}
+	if p.Multiplier < 1 {
+		p.Multiplier = defaultReconnectMultiplier
+	}
+	if p.Jitter < 0 {
+		p.Jitter = 0
+	}
+	if p.Jitter > 1 {
+		p.Jitter = 1
+	}
+}
+
+// backoff returns the backoff after n failed attempts
+func (p *ReconnectPolicy) backoff(n int) time.Duration {
+	backoff := float64(p.InitialBackoff) * math.Pow(p.Multiplier, float64(n-1))
+	if backoff > float64(p.MaxBackoff) {
+		backoff = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		backoff *= 1 - p.Jitter + 2*p.Jitter*rand.Float64()
+	}
+	return time.Duration(backoff)
+}
+
+// reconnector redials the last connected address of the IOSession in background once the
+// read or write on the connection failed.
+type reconnector[IN any, OUT any] struct {
+	bio    *baseIO[IN, OUT]
+	policy ReconnectPolicy
+
+	mu struct {
+		sync.Mutex
+		address      string
+		timeout      time.Duration
+		closed       bool
+		reconnecting bool
+		// waitC closed when the reconnection completed or gave up
+		waitC chan struct{}
+		stopC chan struct{}
+		doneC chan struct{}
+	}
+}
+
+func newReconnector[IN any, OUT any](bio *baseIO[IN, OUT], policy ReconnectPolicy) *reconnector[IN, OUT] {
+	policy.adjust()
+	return &reconnector[IN, OUT]{
+		bio:    bio,
+		policy: policy,
+	}
+}
+
+// setTarget set the address to reconnect
+func (r *reconnector[IN, OUT]) setTarget(address string, timeout time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.mu.address = address
+	r.mu.timeout = timeout
+	if r.policy.ConnectTimeout > 0 {
+		r.mu.timeout = r.policy.ConnectTimeout
+	}
+}
+
+// trigger starts a background reconnection if the error is not a timeout error. Nothing
+// to do if the IOSession is already disconnected by the caller.
+func (r *reconnector[IN, OUT]) trigger(err error) {
+	var ne net.Error
+	if (errors.As(err, &ne) && ne.Timeout()) || !r.bio.Connected() {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.mu.closed || r.mu.reconnecting || r.mu.address == "" {
+		return
+	}
+
+	r.bio.logger.Info("connection failed, start reconnecting",
+		zap.String("address", r.mu.address),
+		zap.Error(err))
+	r.mu.reconnecting = true
+	r.mu.waitC = make(chan struct{})
+	r.mu.stopC = make(chan struct{})
+	r.mu.doneC = make(chan struct{})
+	go r.run(r.mu.address, r.mu.timeout, r.mu.stopC, r.mu.doneC)
+}
+
+// wait waits for the reconnection in progress. Returns immediately if not reconnecting,
+// 0 timeout means no timeout.
+func (r *reconnector[IN, OUT]) wait(timeout time.Duration) {
+	r.mu.Lock()
+	if !r.mu.reconnecting {
+		r.mu.Unlock()
+		return
+	}
+	waitC := r.mu.waitC
+	r.mu.Unlock()
+
+	var timeoutC <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timeoutC = timer.C
+	}
+	select {
+	case <-waitC:
+	case <-timeoutC:
+	}
+}
+
+// close stops the reconnection in progress, and no reconnection will be started after close.
+func (r *reconnector[IN, OUT]) close() {
+	r.mu.Lock()
+	if r.mu.closed {
+		r.mu.Unlock()
+		return
+	}
+	r.mu.closed = true
+	if !r.mu.reconnecting {
+		r.mu.Unlock()
+		return
+	}
+	close(r.mu.stopC)
+	doneC := r.mu.doneC
+	r.mu.Unlock()
+	<-doneC
+}
+
+func (r *reconnector[IN, OUT]) run(address string, timeout time.Duration, stopC, doneC chan struct{}) {
+	defer close(doneC)
+
+	connected := false
+	defer func() {
+		r.mu.Lock()
+		r.mu.reconnecting = false
+		close(r.mu.waitC)
+		r.mu.Unlock()
+		if !connected {
+			r.bio.logger.Info("reconnect stopped without connected",
+				zap.String("address", address))
+		}
+	}()
+
+	if err := r.bio.Disconnect(); err != nil {
+		r.bio.logger.Error("disconnect before reconnect failed",
+			zap.Error(err))
+		return
+	}
+
+	for attempts := 1; ; attempts++ {
+		select {
+		case <-stopC:
+			return
+		default:
+		}
+
+		err := r.bio.Connect(address, timeout)
+		if err == nil {
+			connected = true
+			r.bio.logger.Info("reconnected",
+				zap.String("address", address),
+				zap.Int("attempts", attempts))
+			return
+		}
+		r.bio.logger.Debug("reconnect failed",
+			zap.String("address", address),
+			zap.Int("attempts", attempts),
+			zap.Error(err))
+		if r.policy.MaxAttempts > 0 && attempts >= r.policy.MaxAttempts {
+			return
+		}
+
+		timer := time.NewTimer(r.policy.backoff(attempts))
+		select {
+		case <-stopC:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package goetty
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lni/goutils/leaktest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAutoReconnect(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	for name, address := range testAddresses {
+		addr := address
+		t.Run(name, func(t *testing.T) {
+			echo := func(rs IOSession[string, string], msg string, received uint64) error {
+				return rs.Write(msg, WriteOptions{Flush: true})
+			}
+			app := newTestApp(t, testListenAddresses, echo)
+			assert.NoError(t, app.Start())
+
+			observer := &testStateObserver{}
+			client := newTestIOSession(t,
+				WithSessionAutoReconnect[string, string](ReconnectPolicy{
+					InitialBackoff: time.Millisecond * 10,
+					MaxBackoff:     time.Millisecond * 50,
+					Jitter:         0.2,
+					WaitOnWrite:    true,
+				}),
+				WithSessionStateObserver(observer.observe))
+			assert.NoError(t, client.Connect(addr, time.Second))
+			assert.Equal(t, []SessionState{SessionConnecting, SessionConnected}, observer.getStates())
+
+			// server down, the read failed and start reconnecting
+			assert.NoError(t, app.Stop())
+			_, err := client.Read(ReadOptions{})
+			assert.Error(t, err)
+			time.Sleep(time.Millisecond * 100)
+			assert.False(t, client.Connected())
+
+			app = newTestApp(t, testListenAddresses, echo)
+			assert.NoError(t, app.Start())
+			defer app.Stop()
+
+			assert.NoError(t, client.Write("hello", WriteOptions{Flush: true, Timeout: time.Second * 5}))
+			assert.True(t, client.Connected())
+			reply, err := client.Read(ReadOptions{Timeout: time.Second})
+			assert.NoError(t, err)
+			assert.Equal(t, "hello", reply)
+
+			states := observer.getStates()
+			assert.Contains(t, states, SessionDisconnected)
+			assert.Equal(t, SessionConnected, states[len(states)-1])
+
+			assert.NoError(t, client.Close())
+			assert.Equal(t, SessionClosed, observer.last())
+			_, err = client.Read(ReadOptions{})
+			assert.Equal(t, ErrIllegalState, err)
+			time.Sleep(time.Millisecond * 50)
+			assert.Equal(t, SessionClosed, observer.last())
+		})
+	}
+}
+
+func TestNoReconnectAfterDisconnect(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	app := newTestApp(t, []string{testUnixSocket}, nil)
+	assert.NoError(t, app.Start())
+	defer app.Stop()
+
+	client := newTestIOSession(t,
+		WithSessionAutoReconnect[string, string](ReconnectPolicy{InitialBackoff: time.Millisecond * 10}))
+	defer client.Close()
+	assert.NoError(t, client.Connect(testUnixSocket, time.Second))
+	assert.NoError(t, client.Disconnect())
+	time.Sleep(time.Millisecond * 50)
+	assert.False(t, client.Connected())
+}
+
+func TestCloseWhileReconnecting(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	app := newTestApp(t, []string{testUnixSocket}, nil)
+	assert.NoError(t, app.Start())
+
+	client := newTestIOSession(t,
+		WithSessionAutoReconnect[string, string](ReconnectPolicy{InitialBackoff: time.Millisecond * 10}))
+	assert.NoError(t, client.Connect(testUnixSocket, time.Second))
+	assert.NoError(t, app.Stop())
+	_, err := client.Read(ReadOptions{})
+	assert.Error(t, err)
+	time.Sleep(time.Millisecond * 50)
+	assert.NoError(t, client.Close())
+	assert.False(t, client.Connected())
+}
+
+func TestNoReconnectOnClose(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	created := int32(0)
+	app := newTestApp(t, []string{testUnixSocket}, nil,
+		WithAppSessionAware[string, string](&testSessionAware{
+			created: func() { atomic.AddInt32(&created, 1) },
+			closed:  func() {},
+		}))
+	assert.NoError(t, app.Start())
+	defer app.Stop()
+
+	for i := 0; i < 5; i++ {
+		observer := &testStateObserver{}
+		client := newTestIOSession(t,
+			WithSessionAutoReconnect[string, string](ReconnectPolicy{InitialBackoff: time.Millisecond}),
+			WithSessionStateObserver(observer.observe))
+		assert.NoError(t, client.Connect(testUnixSocket, time.Second))
+
+		readC := make(chan error)
+		go func() {
+			_, err := client.Read(ReadOptions{})
+			readC <- err
+		}()
+		time.Sleep(time.Millisecond * 10)
+		assert.NoError(t, client.Close())
+		assert.Error(t, <-readC)
+		time.Sleep(time.Millisecond * 20)
+		assert.Equal(t, []SessionState{SessionConnecting, SessionConnected, SessionClosed},
+			observer.getStates())
+	}
+	// no connection is reconnected by the closed clients
+	assert.Equal(t, int32(5), atomic.LoadInt32(&created))
+}
+
+func TestReconnectBackoff(t *testing.T) {
+	policy := ReconnectPolicy{
+		InitialBackoff: time.Millisecond * 10,
+		MaxBackoff:     time.Millisecond * 50,
+	}
+	policy.adjust()
+	assert.Equal(t, time.Millisecond*10, policy.backoff(1))
+	assert.Equal(t, time.Millisecond*20, policy.backoff(2))
+	assert.Equal(t, time.Millisecond*40, policy.backoff(3))
+	assert.Equal(t, time.Millisecond*50, policy.backoff(4))
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		v := policy.backoff(1)
+		assert.True(t, v >= time.Millisecond*5 && v <= time.Millisecond*15)
+	}
+}
+
+type testStateObserver struct {
+	sync.Mutex
+	states []SessionState
+}
+
+func (o *testStateObserver) observe(rs IOSession[string, string], state SessionState) {
+	o.Lock()
+	defer o.Unlock()
+	o.states = append(o.states, state)
+}
+
+func (o *testStateObserver) getStates() []SessionState {
+	o.Lock()
+	defer o.Unlock()
+	return append([]SessionState(nil), o.states...)
+}
+
+func (o *testStateObserver) last() SessionState {
+	o.Lock()
+	defer o.Unlock()
+	return o.states[len(o.states)-1]
+}
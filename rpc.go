@@ -0,0 +1,281 @@
+package goetty
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrRPCClientClosed the rpc client is closed
+	ErrRPCClientClosed = errors.New("rpc client closed")
+	// ErrRPCDisconnected the session of the rpc client disconnected before the response received
+	ErrRPCDisconnected = errors.New("rpc session disconnected")
+)
+
+// RPCOption option to create RPCClient
+type RPCOption[IN any, OUT any] func(*rpcClient[IN, OUT])
+
+// WithRPCLogger set logger for RPCClient
+func WithRPCLogger[IN any, OUT any](logger *zap.Logger) RPCOption[IN, OUT] {
+	return func(c *rpcClient[IN, OUT]) {
+		c.logger = logger
+	}
+}
+
+// WithRPCTimeout set the default timeout for the requests which context has no deadline
+func WithRPCTimeout[IN any, OUT any](value time.Duration) RPCOption[IN, OUT] {
+	return func(c *rpcClient[IN, OUT]) {
+		c.options.timeout = value
+	}
+}
+
+// WithRPCUnsolicitedHandler set a func to handle the received messages which have no
+// matching pending request, e.g. the messages pushed by server or the responses of the
+// requests already timeout.
+func WithRPCUnsolicitedHandler[IN any, OUT any](value func(IN)) RPCOption[IN, OUT] {
+	return func(c *rpcClient[IN, OUT]) {
+		c.options.unsolicitedHandler = value
+	}
+}
+
+// RPCClient is used to send requests and receive the correlated responses over an IOSession.
+// Each request is assigned a unique ID, and the response with the same ID is routed to the
+// Future of the request.
+type RPCClient[IN any, OUT any] interface {
+	// Send assigns an ID to the request and writes it, returns a Future to wait the response.
+	// The ctx is used to control the timeout and cancellation of waiting for the response.
+	Send(ctx context.Context, request OUT) (*Future[IN], error)
+	// Close close the client and the IOSession, all pending futures will fail.
+	Close() error
+}
+
+// Future is used to wait for the response of a request
+type Future[T any] struct {
+	id      uint64
+	ctx     context.Context
+	timeout time.Duration
+	doneC   chan struct{}
+	value   T
+	err     error
+	remove  func(uint64)
+}
+
+func newFuture[T any](id uint64, ctx context.Context, timeout time.Duration, remove func(uint64)) *Future[T] {
+	return &Future[T]{
+		id:      id,
+		ctx:     ctx,
+		timeout: timeout,
+		doneC:   make(chan struct{}),
+		remove:  remove,
+	}
+}
+
+// ID returns the request id
+func (f *Future[T]) ID() uint64 {
+	return f.id
+}
+
+// Get waits for the response. Returns error if the context done, timeout or the session
+// disconnected.
+func (f *Future[T]) Get() (T, error) {
+	var timeoutC <-chan time.Time
+	if _, ok := f.ctx.Deadline(); !ok && f.timeout > 0 {
+		timer := time.NewTimer(f.timeout)
+		defer timer.Stop()
+		timeoutC = timer.C
+	}
+
+	select {
+	case <-f.doneC:
+		return f.value, f.err
+	case <-f.ctx.Done():
+		f.remove(f.id)
+		var v T
+		return v, f.ctx.Err()
+	case <-timeoutC:
+		f.remove(f.id)
+		var v T
+		return v, context.DeadlineExceeded
+	}
+}
+
+// Close gives up waiting for the response, the response will be handled as an unsolicited
+// message if received later.
+func (f *Future[T]) Close() {
+	f.remove(f.id)
+}
+
+func (f *Future[T]) done(value T, err error) {
+	f.value = value
+	f.err = err
+	close(f.doneC)
+}
+
+type rpcClient[IN any, OUT any] struct {
+	logger    *zap.Logger
+	session   IOSession[IN, OUT]
+	injectID  func(OUT, uint64) OUT
+	extractID func(IN) uint64
+	doneC     chan struct{}
+
+	mu struct {
+		sync.Mutex
+		closed  bool
+		pending map[uint64]*Future[IN]
+	}
+
+	atomic struct {
+		id uint64
+	}
+
+	options struct {
+		timeout            time.Duration
+		unsolicitedHandler func(IN)
+	}
+}
+
+// NewRPCClient returns a RPCClient over the connected IOSession, the IOSession is owned by the
+// RPCClient and must not be read by others. The injectID is used to set the request ID into
+// the request, and the extractID is used to get the request ID from the response.
+func NewRPCClient[IN any, OUT any](
+	session IOSession[IN, OUT],
+	injectID func(OUT, uint64) OUT,
+	extractID func(IN) uint64,
+	opts ...RPCOption[IN, OUT]) RPCClient[IN, OUT] {
+	c := &rpcClient[IN, OUT]{
+		session:   session,
+		injectID:  injectID,
+		extractID: extractID,
+		doneC:     make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.adjust()
+	c.mu.pending = make(map[uint64]*Future[IN])
+
+	go c.readLoop()
+	return c
+}
+
+func (c *rpcClient[IN, OUT]) adjust() {
+	c.logger = adjustLogger(c.logger).Named("rpc").With(zap.String("addr", c.session.RemoteAddress()))
+	if c.options.unsolicitedHandler == nil {
+		c.options.unsolicitedHandler = func(msg IN) {
+			c.logger.Debug("unsolicited message dropped")
+		}
+	}
+}
+
+func (c *rpcClient[IN, OUT]) Send(ctx context.Context, request OUT) (*Future[IN], error) {
+	id := atomic.AddUint64(&c.atomic.id, 1)
+	f := newFuture[IN](id, ctx, c.options.timeout, c.removePending)
+
+	c.mu.Lock()
+	if c.mu.closed {
+		c.mu.Unlock()
+		return nil, ErrRPCClientClosed
+	}
+	c.mu.pending[id] = f
+	c.mu.Unlock()
+
+	if err := c.session.Write(c.injectID(request, id), WriteOptions{Flush: true}); err != nil {
+		c.removePending(id)
+		return nil, err
+	}
+	return f, nil
+}
+
+func (c *rpcClient[IN, OUT]) Close() error {
+	c.mu.Lock()
+	if c.mu.closed {
+		c.mu.Unlock()
+		<-c.doneC
+		return nil
+	}
+	c.mu.closed = true
+	c.mu.Unlock()
+
+	// stop the read loop before the buffers of the session freed by Close
+	if err := c.session.Disconnect(); err != nil {
+		c.logger.Error("disconnect rpc session failed", zap.Error(err))
+	}
+	<-c.doneC
+	return c.session.Close()
+}
+
+func (c *rpcClient[IN, OUT]) readLoop() {
+	defer close(c.doneC)
+
+	// the IOSession with auto reconnect can be read again after the connection failed
+	reconnectable := false
+	if bio, ok := c.session.(*baseIO[IN, OUT]); ok {
+		reconnectable = bio.reconnector != nil
+	}
+
+	for {
+		msg, err := c.session.Read(ReadOptions{})
+		if err != nil {
+			if reconnectable && err != ErrIllegalState && !c.isClosed() {
+				c.failPending(fmt.Errorf("%w: %s", ErrRPCDisconnected, err))
+				continue
+			}
+
+			c.mu.Lock()
+			closed := c.mu.closed
+			c.mu.closed = true
+			c.mu.Unlock()
+			if closed {
+				c.failPending(ErrRPCClientClosed)
+			} else {
+				c.logger.Info("rpc read loop stopped", zap.Error(err))
+				c.failPending(fmt.Errorf("%w: %s", ErrRPCDisconnected, err))
+			}
+			return
+		}
+
+		id := c.extractID(msg)
+		c.mu.Lock()
+		f, ok := c.mu.pending[id]
+		if ok {
+			delete(c.mu.pending, id)
+		}
+		c.mu.Unlock()
+
+		if ok {
+			f.done(msg, nil)
+		} else {
+			c.options.unsolicitedHandler(msg)
+		}
+	}
+}
+
+func (c *rpcClient[IN, OUT]) failPending(err error) {
+	c.mu.Lock()
+	pending := c.mu.pending
+	c.mu.pending = make(map[uint64]*Future[IN])
+	c.mu.Unlock()
+
+	var v IN
+	for _, f := range pending {
+		f.done(v, err)
+	}
+}
+
+func (c *rpcClient[IN, OUT]) removePending(id uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.mu.pending, id)
+}
+
+func (c *rpcClient[IN, OUT]) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.mu.closed
+}
@@ -0,0 +1,142 @@
+package goetty
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lni/goutils/leaktest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRPCClient(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	for name, address := range testAddresses {
+		addr := address
+		t.Run(name, func(t *testing.T) {
+			app := newTestApp(t, testListenAddresses, handleTestRPCRequest)
+			assert.NoError(t, app.Start())
+			defer app.Stop()
+
+			unsolicited := make(chan string, 1)
+			client := newTestRPCClient(t, addr, WithRPCUnsolicitedHandler[string, string](func(msg string) {
+				unsolicited <- msg
+			}))
+			defer client.Close()
+
+			var wg sync.WaitGroup
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					f, err := client.Send(context.Background(), fmt.Sprintf("hello-%d", i))
+					assert.NoError(t, err)
+					resp, err := f.Get()
+					assert.NoError(t, err)
+					assert.Equal(t, fmt.Sprintf("%d:hello-%d", f.ID(), i), resp)
+				}(i)
+			}
+			wg.Wait()
+
+			f, err := client.Send(context.Background(), "push")
+			assert.NoError(t, err)
+			f.Close()
+			assert.Equal(t, "0:push", <-unsolicited)
+		})
+	}
+}
+
+func TestRPCClientTimeout(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	app := newTestApp(t, testListenAddresses, handleTestRPCRequest)
+	assert.NoError(t, app.Start())
+	defer app.Stop()
+
+	client := newTestRPCClient(t, testUnixSocket, WithRPCTimeout[string, string](time.Millisecond*20))
+	defer client.Close()
+
+	f, err := client.Send(context.Background(), "noreply")
+	assert.NoError(t, err)
+	_, err = f.Get()
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	f, err = client.Send(ctx, "noreply")
+	assert.NoError(t, err)
+	cancel()
+	_, err = f.Get()
+	assert.Equal(t, context.Canceled, err)
+	assert.Empty(t, client.(*rpcClient[string, string]).mu.pending)
+}
+
+func TestRPCClientDisconnected(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	app := newTestApp(t, testListenAddresses, handleTestRPCRequest)
+	assert.NoError(t, app.Start())
+	defer app.Stop()
+
+	client := newTestRPCClient(t, testUnixSocket)
+	f1, err := client.Send(context.Background(), "noreply")
+	assert.NoError(t, err)
+	f2, err := client.Send(context.Background(), "close")
+	assert.NoError(t, err)
+
+	_, err = f1.Get()
+	assert.ErrorIs(t, err, ErrRPCDisconnected)
+	_, err = f2.Get()
+	assert.ErrorIs(t, err, ErrRPCDisconnected)
+
+	_, err = client.Send(context.Background(), "hello")
+	assert.Equal(t, ErrRPCClientClosed, err)
+	assert.NoError(t, client.Close())
+}
+
+func TestRPCClientClose(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	app := newTestApp(t, testListenAddresses, handleTestRPCRequest)
+	assert.NoError(t, app.Start())
+	defer app.Stop()
+
+	client := newTestRPCClient(t, testUnixSocket)
+	f, err := client.Send(context.Background(), "noreply")
+	assert.NoError(t, err)
+	assert.NoError(t, client.Close())
+	_, err = f.Get()
+	assert.Equal(t, ErrRPCClientClosed, err)
+}
+
+// handleTestRPCRequest echoes the request, the message format is id:payload
+func handleTestRPCRequest(rs IOSession[string, string], msg string, received uint64) error {
+	payload := msg[strings.Index(msg, ":")+1:]
+	switch payload {
+	case "noreply":
+		return nil
+	case "close":
+		return rs.Disconnect()
+	case "push":
+		return rs.Write("0:push", WriteOptions{Flush: true})
+	}
+	return rs.Write(msg, WriteOptions{Flush: true})
+}
+
+func newTestRPCClient(t *testing.T, address string, opts ...RPCOption[string, string]) RPCClient[string, string] {
+	session := newTestIOSession(t)
+	assert.NoError(t, session.Connect(address, time.Second))
+	return NewRPCClient(session,
+		func(msg string, id uint64) string {
+			return fmt.Sprintf("%d:%s", id, msg)
+		},
+		func(msg string) uint64 {
+			id, _ := strconv.ParseUint(msg[:strings.Index(msg, ":")], 10, 64)
+			return id
+		},
+		opts...)
+}
@@ -8,7 +8,9 @@ import (
 	"io"
 	"net"
 	"os"
+	"sync"
 	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/fagongzi/goetty/v3/buf"
@@ -34,6 +36,17 @@ type WriteOptions struct {
 	Timeout time.Duration
 	// Flush flush data to net.Conn
 	Flush bool
+	// Callback is called once the msg has been flushed to net.Conn or failed. Only used
+	// when async write is enabled by WithSessionAsyncWrite.
+	Callback func(error)
+}
+
+// WriteFileOptions write file options
+type WriteFileOptions struct {
+	// Timeout deadline for writing each chunk of the file
+	Timeout time.Duration
+	// Progress is called with the total written bytes after each chunk of the file written
+	Progress func(written int64)
 }
 
 // ReadOptions read options
@@ -148,6 +161,101 @@ func WithSessionDisableAutoResetInBuffer[IN any, OUT any]() Option[IN, OUT] {
 	}
 }
 
+// WithSessionAsyncWrite enable async write. Write puts the msg into a bounded queue, and a
+// dedicated goroutine encodes and flushes the queued messages in batches, so the IOSession
+// can be written by multiple goroutines concurrently. Write blocks if the queue is full, the
+// WriteOptions.Timeout is used to control the max time to wait, and WriteOptions.Callback
+// can be used to get the result. When the IOSession is disconnected or closed, the queued
+// messages are flushed before the connection closed.
+func WithSessionAsyncWrite[IN any, OUT any](queueSize int) Option[IN, OUT] {
+	return func(bio *baseIO[IN, OUT]) {
+		bio.options.asyncWrite = true
+		bio.options.asyncWriteQueueSize = queueSize
+	}
+}
+
+// WithSessionHeartbeat enable heartbeat for IOSession. A ping message created by factory is
+// sent if nothing was read in the interval, and the IOSession will be disconnected if nothing
+// was read after maxMissed pings sent. The received ping and pong messages are handled in Read
+// and never returned. If interval is 0, no ping will be sent, but the received ping messages
+// are still replied with pong messages.
+func WithSessionHeartbeat[IN any, OUT any](factory HeartbeatFactory[IN, OUT], interval time.Duration, maxMissed int) Option[IN, OUT] {
+	return func(bio *baseIO[IN, OUT]) {
+		bio.options.heartbeatFactory = factory
+		bio.options.heartbeatInterval = interval
+		bio.options.heartbeatMaxMissed = maxMissed
+	}
+}
+
+// WithSessionAutoReconnect enable auto reconnect for client IOSession. Once the read or write
+// failed on the connection, the IOSession is disconnected and redials the address of the last
+// Connect in background according to the policy. No reconnection will be made after Close.
+// Read waits for the reconnection in progress, and Write waits only if policy.WaitOnWrite is
+// set.
+func WithSessionAutoReconnect[IN any, OUT any](policy ReconnectPolicy) Option[IN, OUT] {
+	return func(bio *baseIO[IN, OUT]) {
+		bio.options.reconnect = true
+		bio.options.reconnectPolicy = policy
+	}
+}
+
+// WithSessionStateObserver set a func to observe the state transitions of IOSession. The func
+// may be called in any goroutine which changes the state.
+func WithSessionStateObserver[IN any, OUT any](value func(IOSession[IN, OUT], SessionState)) Option[IN, OUT] {
+	return func(bio *baseIO[IN, OUT]) {
+		bio.options.stateObserver = value
+	}
+}
+
+// WithSessionInboundInterceptors add interceptors for the messages received by the IOSession,
+// they are called by NetApplication after the application level inbound interceptors and
+// before the handleFunc.
+func WithSessionInboundInterceptors[IN any, OUT any](interceptors ...InboundInterceptor[IN, OUT]) Option[IN, OUT] {
+	return func(bio *baseIO[IN, OUT]) {
+		bio.options.inboundInterceptors = append(bio.options.inboundInterceptors, interceptors...)
+	}
+}
+
+// WithSessionOutboundInterceptors add interceptors for the messages written by the IOSession,
+// they are called in the order added before the messages encoded.
+func WithSessionOutboundInterceptors[IN any, OUT any](interceptors ...OutboundInterceptor[IN, OUT]) Option[IN, OUT] {
+	return func(bio *baseIO[IN, OUT]) {
+		bio.options.outboundInterceptors = append(bio.options.outboundInterceptors, interceptors...)
+	}
+}
+
+// WithSessionLazyBuffers enable lazy buffers to cut the memory of the idle IOSessions. The in
+// and out buffers are not allocated until the first read or write, and are released to the
+// buf.Allocator once nothing was read in the idleTimeout (default 1 minute), then they are
+// reallocated on demand by the next read or write. Only the conns implemented syscall.Conn
+// are supported to release the buffers after idle, the IOSessions driven by the event loop
+// release the buffers once all the read bytes decoded. See MemoryStats to get the memory held
+// by the IOSession.
+func WithSessionLazyBuffers[IN any, OUT any](idleTimeout time.Duration) Option[IN, OUT] {
+	return func(bio *baseIO[IN, OUT]) {
+		bio.options.lazyBuffers = true
+		bio.options.lazyBuffersIdleTimeout = idleTimeout
+	}
+}
+
+// WithSessionVectoredWrite enable vectored writes. The conn passed to the codec implements
+// codec.BuffersWriter, so the codec can append the caller-owned bytes to the outbound buffers
+// instead of copying them into the out buffer, and Flush writes the out buffer and the appended
+// bytes with one writev. The messages are released by the func set by WithSessionReleaseMsgFunc
+// only after the bytes are written or failed to write.
+func WithSessionVectoredWrite[IN any, OUT any]() Option[IN, OUT] {
+	return func(bio *baseIO[IN, OUT]) {
+		bio.options.vectoredWrite = true
+	}
+}
+
+// withSessionCloseConnHook set a func to be called before the net.Conn closed
+func withSessionCloseConnHook[IN any, OUT any](value func()) Option[IN, OUT] {
+	return func(bio *baseIO[IN, OUT]) {
+		bio.options.closeConnHook = value
+	}
+}
+
 // IOSession internally holds a raw net.Conn on which to provide read and write operations
 type IOSession[IN any, OUT any] interface {
 	// ID session id
@@ -169,8 +277,13 @@ type IOSession[IN any, OUT any] interface {
 	Read(option ReadOptions) (IN, error)
 	// Write encodes the msg into a []byte into the buffer according to the codec.Encode.
 	// If flush is set to false, the data will not be written to the underlying socket.
+	// Write and Flush are serialized, but the caller must make sure that the messages written
+	// by multiple goroutines without flush are not mixed up.
+	// If async write is enabled, the msg is put into the write queue, and will be encoded
+	// and flushed in the background.
 	Write(msg OUT, options WriteOptions) error
-	// Flush flush the out buffer
+	// Flush flush the out buffer. If async write is enabled, Flush does nothing since the
+	// out buffer is flushed in the background.
 	Flush(timeout time.Duration) error
 	// RemoteAddress returns remote address, include ip and port
 	RemoteAddress() string
@@ -188,6 +301,41 @@ type IOSession[IN any, OUT any] interface {
 	InBuf() *buf.ByteBuf
 }
 
+// SessionMemoryStats the memory held by the buffers of an IOSession
+type SessionMemoryStats struct {
+	// InBuf capacity of the in buffer
+	InBuf int
+	// OutBuf capacity of the out buffer
+	OutBuf int
+}
+
+// Total returns the total bytes held by the IOSession
+func (s SessionMemoryStats) Total() int {
+	return s.InBuf + s.OutBuf
+}
+
+// MemoryStatsAware is implemented by the IOSessions created by NewIOSession to report the
+// memory held by the buffers. The capacity of the in buffer is updated after read, and the
+// capacity of the out buffer is updated after flush.
+type MemoryStatsAware interface {
+	// MemoryStats returns the memory held by the buffers of the IOSession
+	MemoryStats() SessionMemoryStats
+}
+
+// FileWriter is implemented by the IOSessions created by NewIOSession to write the files to
+// the connection without copying into the out buffer.
+type FileWriter interface {
+	// WriteFile flushes the out buffer, and then writes n bytes of the file from the offset to
+	// the connection in chunks, if n <= 0 the file is written to the end. The kernel sendfile
+	// is used if the connection supports, e.g. *net.TCPConn, otherwise the file is copied by
+	// the buffer, e.g. TLS. The offset of the file is changed. Returns the written bytes of
+	// the file. If async write is enabled, the messages queued before are flushed first.
+	// The write lock of the IOSession is held until the whole file written, so the Write,
+	// Flush and the async writes of the other goroutines are blocked during the transfer,
+	// use WriteFileOptions.Timeout to bound the time of each chunk.
+	WriteFile(f *os.File, offset, n int64, options WriteFileOptions) (int64, error)
+}
+
 // BufferedIOSession is a IOSession that can read from the in-buffer first
 type BufferedIOSession interface {
 	// BufferedConn returns a wrapped net.Conn that read from IOSession's in-buffer first
@@ -203,23 +351,51 @@ type baseIO[IN any, OUT any] struct {
 	out                   *buf.ByteBuf
 	disableConnect        bool
 	logger                *zap.Logger
-	readCopyBuf           []byte
-	writeCopyBuf          []byte
+	asyncWriter           *asyncWriter[IN, OUT]
+	heartbeat             *heartbeat[IN, OUT]
+	reconnector           *reconnector[IN, OUT]
+	outbound              OutboundHandler[IN, OUT]
+	// vectored holds the appended bytes if vectored writes enabled
+	vectored *outBuffers
+	// rawConn is used to wait the conn readable without buffers if lazy buffers enabled
+	rawConn syscall.RawConn
+	// writeMu serializes the encoding and flushing of the out buffer
+	writeMu sync.Mutex
 
 	options struct {
-		aware                             IOSessionAware[IN, OUT]
-		codec                             codec.Codec[IN, OUT]
-		readBufSize, writeBufSize         int
-		readCopyBufSize, writeCopyBufSize int
-		releaseMsgFunc                    func(any)
-		allocator                         buf.Allocator
-		dial                              func(network, address string, timeout time.Duration) (net.Conn, error)
-		disableAutoResetInBuffer          bool
-		disableCompactAfterGrow           bool
+		aware                     IOSessionAware[IN, OUT]
+		codec                     codec.Codec[IN, OUT]
+		readBufSize, writeBufSize int
+		writeCopyBufSize          int
+		releaseMsgFunc            func(any)
+		allocator                 buf.Allocator
+		dial                      func(network, address string, timeout time.Duration) (net.Conn, error)
+		disableAutoResetInBuffer  bool
+		disableCompactAfterGrow   bool
+		asyncWrite                bool
+		asyncWriteQueueSize       int
+		heartbeatFactory          HeartbeatFactory[IN, OUT]
+		heartbeatInterval         time.Duration
+		heartbeatMaxMissed        int
+		reconnect                 bool
+		reconnectPolicy           ReconnectPolicy
+		stateObserver             func(IOSession[IN, OUT], SessionState)
+		inboundInterceptors       []InboundInterceptor[IN, OUT]
+		outboundInterceptors      []OutboundInterceptor[IN, OUT]
+		closeConnHook             func()
+		lazyBuffers               bool
+		lazyBuffersIdleTimeout    time.Duration
+		vectoredWrite             bool
 	}
 
 	atomic struct {
 		ref int32
+		// lastRead and lastWrite unix nano of the last successful read and write
+		lastRead  int64
+		lastWrite int64
+		// inBufSize and outBufSize capacity of the in and out buffers for memory stats
+		inBufSize  int64
+		outBufSize int64
 	}
 }
 
@@ -232,8 +408,22 @@ func NewIOSession[IN any, OUT any](opts ...Option[IN, OUT]) IOSession[IN, OUT] {
 	bio.adjust()
 	bio.Ref()
 
-	bio.readCopyBuf = make([]byte, bio.options.readCopyBufSize)
-	bio.writeCopyBuf = make([]byte, bio.options.writeCopyBufSize)
+	if bio.options.vectoredWrite {
+		bio.vectored = newOutBuffers(bio.options.releaseMsgFunc)
+	}
+	if bio.options.asyncWrite {
+		bio.asyncWriter = newAsyncWriter(bio, bio.options.asyncWriteQueueSize)
+	}
+	if bio.options.heartbeatFactory != nil {
+		bio.heartbeat = newHeartbeat(bio,
+			bio.options.heartbeatFactory,
+			bio.options.heartbeatInterval,
+			bio.options.heartbeatMaxMissed)
+	}
+	if bio.options.reconnect {
+		bio.reconnector = newReconnector(bio, bio.options.reconnectPolicy)
+	}
+	bio.resetOutbound()
 	if bio.conn != nil {
 		bio.initConn()
 		bio.disableConnect = true
@@ -249,9 +439,6 @@ func (bio *baseIO[IN, OUT]) adjust() {
 	if bio.options.readBufSize == 0 {
 		bio.options.readBufSize = defaultReadBuf
 	}
-	if bio.options.readCopyBufSize == 0 {
-		bio.options.readCopyBufSize = defaultReadCopyBuf
-	}
 	if bio.options.writeBufSize == 0 {
 		bio.options.writeBufSize = defaultWriteBuf
 	}
@@ -261,9 +448,18 @@ func (bio *baseIO[IN, OUT]) adjust() {
 	if bio.options.releaseMsgFunc == nil {
 		bio.options.releaseMsgFunc = func(any) {}
 	}
+	if bio.options.stateObserver == nil {
+		bio.options.stateObserver = func(IOSession[IN, OUT], SessionState) {}
+	}
 	if bio.options.dial == nil {
 		bio.options.dial = net.DialTimeout
 	}
+	if bio.options.asyncWriteQueueSize <= 0 {
+		bio.options.asyncWriteQueueSize = defaultAsyncWriteQueueSize
+	}
+	if bio.options.lazyBuffers && bio.options.lazyBuffersIdleTimeout <= 0 {
+		bio.options.lazyBuffersIdleTimeout = defaultLazyBuffersIdleTimeout
+	}
 }
 
 func (bio *baseIO[IN, OUT]) ID() uint64 {
@@ -300,14 +496,19 @@ func (bio *baseIO[IN, OUT]) Connect(addressWithNetwork string, timeout time.Dura
 		return fmt.Errorf("the session is closing or connecting is other goroutine")
 	}
 
+	bio.options.stateObserver(bio, SessionConnecting)
 	conn, err := bio.options.dial(network, address, timeout)
 	if nil != err {
 		atomic.StoreInt32(&bio.state, stateReadyToConnect)
+		bio.options.stateObserver(bio, SessionDisconnected)
 		return err
 	}
 
 	bio.conn = conn
 	bio.initConn()
+	if bio.reconnector != nil {
+		bio.reconnector.setTarget(addressWithNetwork, timeout)
+	}
 	return nil
 }
 
@@ -326,6 +527,10 @@ func (bio *baseIO[IN, OUT]) Disconnect() error {
 		break
 	}
 
+	if bio.asyncWriter != nil {
+		// the queued messages can only be flushed in the connected state
+		bio.asyncWriter.stop(defaultAsyncWriteDrainTimeout)
+	}
 	if !atomic.CompareAndSwapInt32(&bio.state, stateConnected, stateReadyToConnect) {
 		current := bio.getState()
 		if current == stateReadyToConnect {
@@ -336,6 +541,7 @@ func (bio *baseIO[IN, OUT]) Disconnect() error {
 
 	bio.closeConn()
 	atomic.StoreInt32(&bio.state, stateReadyToConnect)
+	bio.options.stateObserver(bio, SessionDisconnected)
 	return nil
 }
 
@@ -357,19 +563,31 @@ func (bio *baseIO[IN, OUT]) BufferedConn() net.Conn {
 
 func (bio *baseIO[IN, OUT]) UseConn(conn net.Conn) {
 	bio.conn = conn
+	if bio.vectored != nil {
+		bio.vectored.reset(conn, bio.out)
+	}
+	bio.rawConn = nil
+	if bio.options.lazyBuffers {
+		bio.rawConn = syscallRawConn(conn)
+	}
 }
 
 func (bio *baseIO[IN, OUT]) Close() error {
-	bio.closeConn()
-
 	ref := bio.unRef()
 	if ref < 0 {
 		panic("invalid ref count")
 	}
 	if ref > 0 {
+		bio.closeConn()
 		return nil
 	}
 
+	// the reads and writes failed by the closed connection must not start a reconnection
+	if bio.reconnector != nil {
+		bio.reconnector.close()
+	}
+	bio.closeConn()
+
 OUTER:
 	for {
 		old := bio.getState()
@@ -386,14 +604,23 @@ OUTER:
 		}
 	}
 
+	// the concurrent writers check the state after the lock held
+	bio.writeMu.Lock()
+	if bio.vectored != nil {
+		bio.vectored.done()
+	}
 	if bio.out != nil {
 		bio.out.Close()
 	}
+	bio.writeMu.Unlock()
 	if bio.in != nil {
 		bio.in.Close()
 	}
+	atomic.StoreInt64(&bio.atomic.inBufSize, 0)
+	atomic.StoreInt64(&bio.atomic.outBufSize, 0)
 
 	atomic.StoreInt32(&bio.state, stateClosed)
+	bio.options.stateObserver(bio, SessionClosed)
 	if bio.options.aware != nil {
 		bio.options.aware.Closed(bio)
 	}
@@ -404,6 +631,9 @@ OUTER:
 func (bio *baseIO[IN, OUT]) Read(options ReadOptions) (IN, error) {
 	var msg IN
 	for {
+		if !bio.Connected() && bio.reconnector != nil {
+			bio.reconnector.wait(options.Timeout)
+		}
 		if !bio.Connected() {
 			return msg, ErrIllegalState
 		}
@@ -412,7 +642,7 @@ func (bio *baseIO[IN, OUT]) Read(options ReadOptions) (IN, error) {
 		var complete bool
 		for {
 			if bio.in.Readable() > 0 {
-				msg, complete, err = bio.options.codec.Decode(bio.in)
+				msg, complete, err = bio.decode()
 				if !complete && err == nil {
 					msg, complete, err = bio.readFromConn(options.Timeout)
 				}
@@ -426,6 +656,9 @@ func (bio *baseIO[IN, OUT]) Read(options ReadOptions) (IN, error) {
 
 			if nil != err {
 				bio.in.Reset()
+				if bio.reconnector != nil {
+					bio.reconnector.trigger(err)
+				}
 				return msg, err
 			}
 
@@ -434,6 +667,9 @@ func (bio *baseIO[IN, OUT]) Read(options ReadOptions) (IN, error) {
 					bio.in.Reset()
 				}
 
+				if bio.heartbeat != nil && bio.heartbeat.handle(msg) {
+					continue
+				}
 				return msg, nil
 			}
 		}
@@ -443,18 +679,41 @@ func (bio *baseIO[IN, OUT]) Read(options ReadOptions) (IN, error) {
 func (bio *baseIO[IN, OUT]) Write(
 	msg OUT,
 	options WriteOptions) error {
+	if bio.outbound != nil {
+		return bio.outbound(bio, msg, options)
+	}
+	return bio.doWrite(msg, options)
+}
+
+func (bio *baseIO[IN, OUT]) doWrite(
+	msg OUT,
+	options WriteOptions) error {
+	if !bio.Connected() &&
+		bio.reconnector != nil &&
+		bio.options.reconnectPolicy.WaitOnWrite {
+		bio.reconnector.wait(options.Timeout)
+	}
 	if !bio.Connected() {
 		return ErrIllegalState
 	}
 
-	err := bio.options.codec.Encode(msg, bio.out, bio.conn)
-	bio.options.releaseMsgFunc(msg)
+	if bio.asyncWriter != nil {
+		return bio.asyncWriter.enqueue(msg, options)
+	}
+
+	bio.writeMu.Lock()
+	defer bio.writeMu.Unlock()
+	if !bio.Connected() {
+		return ErrIllegalState
+	}
+
+	err := bio.encode(msg)
 	if err != nil {
 		return err
 	}
 
-	if options.Flush && bio.out.Readable() > 0 {
-		err = bio.Flush(options.Timeout)
+	if options.Flush && bio.pendingFlush() {
+		err = bio.doFlush(options.Timeout)
 		if err != nil {
 			return err
 		}
@@ -464,21 +723,132 @@ func (bio *baseIO[IN, OUT]) Write(
 }
 
 func (bio *baseIO[IN, OUT]) Flush(timeout time.Duration) error {
+	if bio.asyncWriter != nil {
+		return nil
+	}
+
+	bio.writeMu.Lock()
+	defer bio.writeMu.Unlock()
+	return bio.doFlush(timeout)
+}
+
+func (bio *baseIO[IN, OUT]) WriteFile(f *os.File, offset, n int64, options WriteFileOptions) (int64, error) {
+	if n <= 0 {
+		stat, err := f.Stat()
+		if err != nil {
+			return 0, err
+		}
+		n = stat.Size() - offset
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	// the queued messages must be written before the file, the queue is closed if the
+	// session is not connected, which is checked below.
+	if bio.asyncWriter != nil {
+		if err := bio.asyncWriter.flush(options.Timeout); err != nil &&
+			err != ErrWriteQueueClosed {
+			return 0, err
+		}
+	}
+
+	bio.writeMu.Lock()
+	defer bio.writeMu.Unlock()
+
+	if !bio.Connected() {
+		return 0, ErrIllegalState
+	}
+	if bio.pendingFlush() {
+		if err := bio.doFlush(options.Timeout); err != nil {
+			return 0, err
+		}
+	}
+
+	copyBuf := acquireCopyBuf(bio.options.writeCopyBufSize)
+	defer releaseCopyBuf(bio.options.writeCopyBufSize, copyBuf)
+	written := int64(0)
+	for written < n {
+		chunk := n - written
+		if chunk > defaultWriteFileChunkSize {
+			chunk = defaultWriteFileChunkSize
+		}
+		if options.Timeout > 0 {
+			bio.conn.SetWriteDeadline(time.Now().Add(options.Timeout))
+		} else {
+			bio.conn.SetWriteDeadline(time.Time{})
+		}
+
+		// the *io.LimitedReader of *os.File is required by the sendfile of the net.Conn
+		v, err := io.CopyBuffer(bio.conn, &io.LimitedReader{R: f, N: chunk}, *copyBuf)
+		written += v
+		if err == nil && v < chunk {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			if bio.reconnector != nil {
+				bio.reconnector.trigger(err)
+			}
+			return written, err
+		}
+
+		atomic.StoreInt64(&bio.atomic.lastWrite, time.Now().UnixNano())
+		if options.Progress != nil {
+			options.Progress(written)
+		}
+	}
+	return written, nil
+}
+
+// encode encodes the msg into the out buffer, and releases the msg. The msg is released after
+// flushed if vectored writes enabled.
+func (bio *baseIO[IN, OUT]) encode(msg OUT) error {
+	if bio.vectored != nil {
+		bio.vectored.hold(msg)
+		return bio.options.codec.Encode(msg, bio.out, bio.vectored)
+	}
+
+	err := bio.options.codec.Encode(msg, bio.out, bio.conn)
+	bio.options.releaseMsgFunc(msg)
+	return err
+}
+
+// pendingFlush returns true if any data in the out buffer or appended to the vectored writes
+func (bio *baseIO[IN, OUT]) pendingFlush() bool {
+	return bio.out.Readable() > 0 || (bio.vectored != nil && bio.vectored.pending())
+}
+
+// doFlush flush the out buffer to the net.Conn, the write deadline will not be changed if
+// the timeout is negative.
+func (bio *baseIO[IN, OUT]) doFlush(timeout time.Duration) error {
 	defer bio.out.Reset()
+	if bio.vectored != nil {
+		defer bio.vectored.done()
+	}
 	if !bio.Connected() {
 		return ErrIllegalState
 	}
 
-	if timeout != 0 {
+	if timeout > 0 {
 		bio.conn.SetWriteDeadline(time.Now().Add(timeout))
-	} else {
+	} else if timeout == 0 {
 		bio.conn.SetWriteDeadline(time.Time{})
 	}
 
-	_, err := io.CopyBuffer(bio.conn, bio.out, bio.writeCopyBuf)
+	var err error
+	if bio.vectored != nil && bio.vectored.pending() {
+		_, err = bio.vectored.writeTo(bio.conn)
+	} else {
+		_, err = bio.out.WriteTo(bio.conn)
+	}
+	atomic.StoreInt64(&bio.atomic.outBufSize, int64(bio.out.Capacity()))
 	if err == nil || err == io.EOF {
+		atomic.StoreInt64(&bio.atomic.lastWrite, time.Now().UnixNano())
 		return nil
 	}
+	if bio.reconnector != nil {
+		bio.reconnector.trigger(err)
+	}
 	return err
 }
 
@@ -494,25 +864,95 @@ func (bio *baseIO[IN, OUT]) InBuf() *buf.ByteBuf {
 	return bio.in
 }
 
+// MemoryStats implements MemoryStatsAware
+func (bio *baseIO[IN, OUT]) MemoryStats() SessionMemoryStats {
+	return SessionMemoryStats{
+		InBuf:  int(atomic.LoadInt64(&bio.atomic.inBufSize)),
+		OutBuf: int(atomic.LoadInt64(&bio.atomic.outBufSize)),
+	}
+}
+
 func (bio *baseIO[IN, OUT]) readFromConn(timeout time.Duration) (IN, bool, error) {
 	var v IN
+	var deadline time.Time
 	if timeout != 0 {
-		bio.conn.SetReadDeadline(time.Now().Add(timeout))
-	} else {
-		bio.conn.SetReadDeadline(time.Time{})
+		deadline = time.Now().Add(timeout)
 	}
+	if bio.rawConn != nil && bio.in.Readable() == 0 {
+		if err := bio.waitReadable(deadline); err != nil {
+			return v, false, err
+		}
+	}
+	bio.conn.SetReadDeadline(deadline)
 
-	n, err := io.CopyBuffer(bio.in, bio.conn, bio.readCopyBuf)
+	n, err := bio.in.ReadFrom(bio.conn)
 	if err != nil {
+		// the in buffer may be released by the concurrent Close which failed the read
 		return v, false, err
 	}
+	atomic.StoreInt64(&bio.atomic.inBufSize, int64(bio.in.Capacity()))
 	if n == 0 {
 		return v, false, io.EOF
 	}
-	return bio.options.codec.Decode(bio.in)
+	atomic.StoreInt64(&bio.atomic.lastRead, time.Now().UnixNano())
+	return bio.decode()
+}
+
+// waitReadable waits the conn readable without the buffers, the buffers are released if nothing
+// was read in the idle timeout of the lazy buffers.
+func (bio *baseIO[IN, OUT]) waitReadable(deadline time.Time) error {
+	if bio.in.Capacity() > 0 || atomic.LoadInt64(&bio.atomic.outBufSize) > 0 {
+		idle := time.Now().Add(bio.options.lazyBuffersIdleTimeout)
+		if deadline.IsZero() || idle.Before(deadline) {
+			bio.conn.SetReadDeadline(idle)
+			err := waitConnReadable(bio.rawConn)
+			if err == nil || !errors.Is(err, os.ErrDeadlineExceeded) {
+				return err
+			}
+			bio.releaseBuffers()
+			bio.logger.Debug("session buffers released after idle")
+		}
+	}
+
+	bio.conn.SetReadDeadline(deadline)
+	return waitConnReadable(bio.rawConn)
+}
+
+// releaseBuffers releases the empty in and out buffers to the allocator, must be called in the
+// goroutine which reads the in buffer
+func (bio *baseIO[IN, OUT]) releaseBuffers() {
+	bio.in.Shrink(0)
+	atomic.StoreInt64(&bio.atomic.inBufSize, int64(bio.in.Capacity()))
+	bio.releaseOutBuffer()
+}
+
+// releaseOutBuffer releases the empty out buffer to the allocator
+func (bio *baseIO[IN, OUT]) releaseOutBuffer() {
+	bio.writeMu.Lock()
+	bio.out.Shrink(0)
+	atomic.StoreInt64(&bio.atomic.outBufSize, int64(bio.out.Capacity()))
+	bio.writeMu.Unlock()
+}
+
+// decode decodes a message from the in buffer, the error of the codec is wrapped as CodecError
+func (bio *baseIO[IN, OUT]) decode() (IN, bool, error) {
+	msg, complete, err := bio.options.codec.Decode(bio.in)
+	if err != nil {
+		return msg, complete, &CodecError{Err: err}
+	}
+	return msg, complete, nil
 }
 
 func (bio *baseIO[IN, OUT]) closeConn() {
+	if bio.options.closeConnHook != nil {
+		bio.options.closeConnHook()
+	}
+	if bio.heartbeat != nil {
+		bio.heartbeat.stop()
+	}
+	if bio.asyncWriter != nil {
+		bio.asyncWriter.stop(defaultAsyncWriteDrainTimeout)
+	}
 	if bio.conn != nil {
 		if err := bio.conn.Close(); err != nil {
 			bio.logger.Error("close connection failed",
@@ -523,6 +963,11 @@ func (bio *baseIO[IN, OUT]) closeConn() {
 	}
 }
 
+// activeTime returns the unix nano of the last successful read and write
+func (bio *baseIO[IN, OUT]) activeTime() (int64, int64) {
+	return atomic.LoadInt64(&bio.atomic.lastRead), atomic.LoadInt64(&bio.atomic.lastWrite)
+}
+
 func (bio *baseIO[IN, OUT]) getState() int32 {
 	return atomic.LoadInt32(&bio.state)
 }
@@ -530,12 +975,34 @@ func (bio *baseIO[IN, OUT]) getState() int32 {
 func (bio *baseIO[IN, OUT]) initConn() {
 	bio.remoteAddr = bio.conn.RemoteAddr().String()
 	bio.localAddr = bio.conn.LocalAddr().String()
-	bio.in = buf.NewByteBuf(bio.options.readBufSize,
+	readBufSize, writeBufSize := bio.options.readBufSize, bio.options.writeBufSize
+	if bio.options.lazyBuffers {
+		readBufSize, writeBufSize = 0, 0
+		bio.rawConn = syscallRawConn(bio.conn)
+	}
+	bio.in = buf.NewByteBuf(readBufSize,
 		buf.WithDisableCompactAfterGrow(bio.options.disableCompactAfterGrow),
 		buf.WithMemAllocator(bio.options.allocator))
-	bio.out = buf.NewByteBuf(bio.options.writeBufSize,
+	bio.out = buf.NewByteBuf(writeBufSize,
 		buf.WithDisableCompactAfterGrow(bio.options.disableCompactAfterGrow),
 		buf.WithMemAllocator(bio.options.allocator))
+	atomic.StoreInt64(&bio.atomic.inBufSize, int64(readBufSize))
+	atomic.StoreInt64(&bio.atomic.outBufSize, int64(writeBufSize))
+	if bio.vectored != nil {
+		// drop the bytes appended before reconnected
+		bio.vectored.done()
+		bio.vectored.reset(bio.conn, bio.out)
+	}
+	now := time.Now().UnixNano()
+	atomic.StoreInt64(&bio.atomic.lastRead, now)
+	atomic.StoreInt64(&bio.atomic.lastWrite, now)
 	atomic.StoreInt32(&bio.state, stateConnected)
+	bio.options.stateObserver(bio, SessionConnected)
+	if bio.asyncWriter != nil {
+		bio.asyncWriter.start()
+	}
+	if bio.heartbeat != nil {
+		bio.heartbeat.start()
+	}
 	bio.logger.Debug("session init completed")
 }
@@ -0,0 +1,107 @@
+package goetty
+
+import (
+	"net"
+
+	"github.com/fagongzi/goetty/v3/buf"
+	"github.com/fagongzi/goetty/v3/codec"
+)
+
+var _ codec.BuffersWriter = (*outBuffers)(nil)
+
+// outBuffers is the codec.BuffersWriter passed to the codec if the vectored writes enabled. The
+// appended bytes are kept in order with the data encoded into the out buffer, and all of them
+// are written with one writev by Flush. The messages are released after flushed, since the
+// appended bytes may be owned by the messages.
+type outBuffers struct {
+	conn     net.Conn
+	out      *buf.ByteBuf
+	segments []outSegment
+	appended int
+	iov      net.Buffers
+	messages []any
+	release  func(any)
+}
+
+// outSegment the appended bytes, and the size of the out buffer data before them
+type outSegment struct {
+	offset int
+	data   []byte
+}
+
+func newOutBuffers(release func(any)) *outBuffers {
+	return &outBuffers{release: release}
+}
+
+// reset resets with the new conn and out buffer of the session
+func (w *outBuffers) reset(conn net.Conn, out *buf.ByteBuf) {
+	w.conn = conn
+	w.out = out
+}
+
+// Write writes to the conn directly
+func (w *outBuffers) Write(p []byte) (int, error) {
+	return w.conn.Write(p)
+}
+
+// AppendBuffer implements codec.BuffersWriter
+func (w *outBuffers) AppendBuffer(data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	w.segments = append(w.segments, outSegment{offset: w.out.Readable(), data: data})
+	w.appended += len(data)
+}
+
+// Appended implements codec.BuffersWriter
+func (w *outBuffers) Appended() int {
+	return w.appended
+}
+
+// hold holds the message until flushed
+func (w *outBuffers) hold(msg any) {
+	w.messages = append(w.messages, msg)
+}
+
+// pending returns true if any bytes appended or any messages held
+func (w *outBuffers) pending() bool {
+	return len(w.segments) > 0 || len(w.messages) > 0
+}
+
+// writeTo writes the data of the out buffer and the appended bytes with writev
+func (w *outBuffers) writeTo(conn net.Conn) (int64, error) {
+	offset := 0
+	readIndex := w.out.GetReadIndex()
+	for _, seg := range w.segments {
+		if seg.offset > offset {
+			w.iov = append(w.iov, w.out.RawSlice(readIndex+offset, readIndex+seg.offset))
+			offset = seg.offset
+		}
+		w.iov = append(w.iov, seg.data)
+	}
+	if readable := w.out.Readable(); readable > offset {
+		w.iov = append(w.iov, w.out.RawSlice(readIndex+offset, readIndex+readable))
+	}
+
+	iov := w.iov
+	n, err := iov.WriteTo(conn)
+	for idx := range w.iov {
+		w.iov[idx] = nil
+	}
+	w.iov = w.iov[:0]
+	return n, err
+}
+
+// done drops the appended bytes and releases the held messages after flushed or failed
+func (w *outBuffers) done() {
+	for idx := range w.segments {
+		w.segments[idx] = outSegment{}
+	}
+	w.segments = w.segments[:0]
+	w.appended = 0
+	for idx, msg := range w.messages {
+		w.release(msg)
+		w.messages[idx] = nil
+	}
+	w.messages = w.messages[:0]
+}
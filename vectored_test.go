@@ -0,0 +1,84 @@
+package goetty
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fagongzi/goetty/v3/codec/simple"
+	"github.com/lni/goutils/leaktest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVectoredWrite(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	assert.NoError(t, os.RemoveAll(testUnixSocket[7:]))
+	app, err := NewApplicationWithListenAddress(testListenAddresses,
+		func(rs IOSession[[]byte, []byte], msg []byte, received uint64) error {
+			return rs.Write(msg, WriteOptions{Flush: true})
+		},
+		WithAppSessionOptions(
+			WithSessionCodec(simple.NewBytesCodec()),
+			WithSessionVectoredWrite[[]byte, []byte]()))
+	assert.NoError(t, err)
+	assert.NoError(t, app.Start())
+	defer app.Stop()
+
+	for name, address := range testAddresses {
+		addr := address
+		t.Run(name, func(t *testing.T) {
+			released := int32(0)
+			rs := NewIOSession(WithSessionCodec(simple.NewBytesCodec()),
+				WithSessionVectoredWrite[[]byte, []byte](),
+				WithSessionReleaseMsgFunc[[]byte, []byte](func(any) {
+					atomic.AddInt32(&released, 1)
+				}))
+			defer rs.Close()
+			assert.NoError(t, rs.Connect(addr, time.Second))
+
+			var messages [][]byte
+			for i := 0; i < 10; i++ {
+				messages = append(messages, []byte(fmt.Sprintf("message-%d", i)))
+			}
+			messages = append(messages, bytes.Repeat([]byte("x"), 1024*1024))
+			for _, msg := range messages {
+				assert.NoError(t, rs.Write(msg, WriteOptions{}))
+			}
+			// the payloads are appended to the outbound buffers instead of copied
+			assert.Equal(t, 4*len(messages), rs.OutBuf().Readable())
+			assert.Equal(t, int32(0), atomic.LoadInt32(&released))
+
+			assert.NoError(t, rs.Flush(time.Second))
+			assert.Equal(t, int32(len(messages)), atomic.LoadInt32(&released))
+			for _, msg := range messages {
+				reply, err := rs.Read(ReadOptions{Timeout: time.Second * 5})
+				assert.NoError(t, err)
+				assert.Equal(t, msg, reply)
+			}
+		})
+	}
+}
+
+func TestVectoredWriteReleaseOnClose(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	app := newTestApp(t, []string{testUnixSocket}, nil)
+	assert.NoError(t, app.Start())
+	defer app.Stop()
+
+	released := int32(0)
+	rs := newTestIOSession(t,
+		WithSessionVectoredWrite[string, string](),
+		WithSessionReleaseMsgFunc[string, string](func(any) {
+			atomic.AddInt32(&released, 1)
+		}))
+	assert.NoError(t, rs.Connect(testUnixSocket, time.Second))
+	assert.NoError(t, rs.Write("hello", WriteOptions{}))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&released))
+	assert.NoError(t, rs.Close())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&released))
+}
@@ -0,0 +1,212 @@
+package goetty
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrWorkerQueueFull the worker queue is full, returned with BackpressureClose
+	ErrWorkerQueueFull = errors.New("worker queue is full")
+	// errWorkerPoolStopped the worker pool is stopped
+	errWorkerPoolStopped = errors.New("worker pool stopped")
+)
+
+// WorkerPoolMode decides how the messages are dispatched to the workers
+type WorkerPoolMode int
+
+const (
+	// WorkerPoolOrdered dispatches the messages of a session to a fixed worker by the session
+	// id, so the messages of a session are handled in order.
+	WorkerPoolOrdered WorkerPoolMode = iota
+	// WorkerPoolUnordered dispatches the messages to any idle worker, the messages of a session
+	// may be handled concurrently.
+	WorkerPoolUnordered
+)
+
+// BackpressurePolicy decides what to do when the worker queue is full
+type BackpressurePolicy int
+
+const (
+	// BackpressureBlock blocks reading the session until the queue has space. The sessions
+	// driven by the event loop are closed instead, since blocking the event loop blocks all
+	// the sessions of the event loop.
+	BackpressureBlock BackpressurePolicy = iota
+	// BackpressureDrop drops the message
+	BackpressureDrop
+	// BackpressureClose closes the session
+	BackpressureClose
+)
+
+// WorkerPoolConfig config of the worker pool to handle the messages of all sessions of a
+// NetApplication
+type WorkerPoolConfig struct {
+	// Workers number of the workers. Default is 64.
+	Workers int
+	// QueueSize max number of the queued messages of each worker in WorkerPoolOrdered mode,
+	// or of all workers in WorkerPoolUnordered mode. Default is 1024.
+	QueueSize int
+	// Mode how the messages are dispatched to the workers
+	Mode WorkerPoolMode
+	// Backpressure what to do when the queue is full
+	Backpressure BackpressurePolicy
+}
+
+func (c *WorkerPoolConfig) adjust() {
+	if c.Workers <= 0 {
+		c.Workers = defaultWorkerPoolSize
+	}
+	if c.QueueSize <= 0 {
+		c.QueueSize = defaultWorkerQueueSize
+	}
+}
+
+// workerSession is the state of a session handled by the worker pool
+type workerSession[IN any, OUT any] struct {
+	rs      IOSession[IN, OUT]
+	handler InboundHandler[IN, OUT]
+	logger  *zap.Logger
+	// pending number of the dispatched but not handled messages
+	pending sync.WaitGroup
+	// closed the queued messages of the closed session are skipped
+	closed int32
+	// bio is set if the session is driven by the event loop, the out buffer is released after
+	// the message handled
+	bio *baseIO[IN, OUT]
+}
+
+// close waits for the dispatched messages handled, the queued messages are skipped if skip
+// is true.
+func (ws *workerSession[IN, OUT]) close(skip bool) {
+	if skip {
+		atomic.StoreInt32(&ws.closed, 1)
+	}
+	ws.pending.Wait()
+}
+
+func (ws *workerSession[IN, OUT]) isClosed() bool {
+	return atomic.LoadInt32(&ws.closed) == 1
+}
+
+type workerTask[IN any, OUT any] struct {
+	ws       *workerSession[IN, OUT]
+	msg      IN
+	received uint64
+}
+
+// workerPool handles the messages read by the sessions with a fixed number of workers
+type workerPool[IN any, OUT any] struct {
+	s      *server[IN, OUT]
+	cfg    WorkerPoolConfig
+	queues []chan workerTask[IN, OUT]
+	stopC  chan struct{}
+	wg     sync.WaitGroup
+}
+
+func newWorkerPool[IN any, OUT any](s *server[IN, OUT], cfg WorkerPoolConfig) *workerPool[IN, OUT] {
+	cfg.adjust()
+	p := &workerPool[IN, OUT]{
+		s:     s,
+		cfg:   cfg,
+		stopC: make(chan struct{}),
+	}
+	if cfg.Mode == WorkerPoolOrdered {
+		p.queues = make([]chan workerTask[IN, OUT], cfg.Workers)
+		for i := range p.queues {
+			p.queues[i] = make(chan workerTask[IN, OUT], cfg.QueueSize)
+		}
+	} else {
+		p.queues = []chan workerTask[IN, OUT]{make(chan workerTask[IN, OUT], cfg.QueueSize)}
+	}
+	return p
+}
+
+func (p *workerPool[IN, OUT]) start() {
+	for i := 0; i < p.cfg.Workers; i++ {
+		p.wg.Add(1)
+		go p.run(p.queues[i%len(p.queues)])
+	}
+}
+
+// stop stops all workers, it must be called after all sessions closed
+func (p *workerPool[IN, OUT]) stop() {
+	close(p.stopC)
+	p.wg.Wait()
+}
+
+// dispatch queues the message to be handled by the workers, returns error if the session
+// should be closed.
+func (p *workerPool[IN, OUT]) dispatch(ws *workerSession[IN, OUT], msg IN, received uint64) error {
+	q := p.queues[0]
+	if p.cfg.Mode == WorkerPoolOrdered {
+		q = p.queues[ws.rs.ID()%uint64(len(p.queues))]
+	}
+
+	task := workerTask[IN, OUT]{ws: ws, msg: msg, received: received}
+	ws.pending.Add(1)
+	select {
+	case q <- task:
+		return nil
+	default:
+	}
+
+	policy := p.cfg.Backpressure
+	if policy == BackpressureBlock && ws.bio != nil {
+		policy = BackpressureClose
+	}
+	switch policy {
+	case BackpressureDrop:
+		ws.pending.Done()
+		ws.logger.Debug("worker queue is full, message dropped",
+			zap.Uint64("sequence", received))
+		return nil
+	case BackpressureClose:
+		ws.pending.Done()
+		return ErrWorkerQueueFull
+	}
+
+	select {
+	case q <- task:
+		return nil
+	case <-p.stopC:
+		ws.pending.Done()
+		return errWorkerPoolStopped
+	}
+}
+
+func (p *workerPool[IN, OUT]) run(q chan workerTask[IN, OUT]) {
+	defer p.wg.Done()
+	for {
+		select {
+		case <-p.stopC:
+			return
+		case task := <-q:
+			p.handle(task)
+		}
+	}
+}
+
+func (p *workerPool[IN, OUT]) handle(task workerTask[IN, OUT]) {
+	ws := task.ws
+	defer ws.pending.Done()
+	if ws.isClosed() {
+		return
+	}
+
+	err := p.s.handleMessage(ws.handler, ws.rs, task.msg, task.received, ws.logger)
+	if ws.bio != nil && ws.bio.Connected() {
+		ws.bio.releaseOutBuffer()
+	}
+	if err = p.s.checkHandleError(ws.rs, task.msg, err, ws.logger); err != nil {
+		// the read loop of the session will be stopped by the disconnected connection
+		if atomic.CompareAndSwapInt32(&ws.closed, 0, 1) {
+			if err := ws.rs.Disconnect(); err != nil {
+				ws.logger.Error("disconnect session failed",
+					zap.Error(err))
+			}
+		}
+	}
+}
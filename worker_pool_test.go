@@ -0,0 +1,144 @@
+package goetty
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lni/goutils/leaktest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWorkerPoolOrdered(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	app := newTestApp(t,
+		testListenAddresses,
+		func(rs IOSession[string, string], msg string, received uint64) error {
+			return rs.Write(fmt.Sprintf("%d:%s", received, msg), WriteOptions{Flush: true})
+		},
+		WithAppWorkerPool[string, string](WorkerPoolConfig{Workers: 4}))
+	assert.NoError(t, app.Start())
+	defer app.Stop()
+
+	for name, address := range testAddresses {
+		addr := address
+		t.Run(name, func(t *testing.T) {
+			rs := newTestIOSession(t)
+			defer rs.Close()
+			assert.NoError(t, rs.Connect(addr, time.Second))
+
+			n := 100
+			for i := 1; i <= n; i++ {
+				assert.NoError(t, rs.Write(fmt.Sprintf("%d", i), WriteOptions{}))
+			}
+			assert.NoError(t, rs.Flush(time.Second))
+			for i := 1; i <= n; i++ {
+				reply, err := rs.Read(ReadOptions{Timeout: time.Second})
+				assert.NoError(t, err)
+				assert.Equal(t, fmt.Sprintf("%d:%d", i, i), reply)
+			}
+		})
+	}
+}
+
+func TestWorkerPoolUnordered(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	// the handlers wait for each other, so the messages must be handled concurrently
+	n := int32(4)
+	handling := int32(0)
+	app := newTestApp(t,
+		[]string{testUnixSocket},
+		func(rs IOSession[string, string], msg string, received uint64) error {
+			atomic.AddInt32(&handling, 1)
+			for atomic.LoadInt32(&handling) < n {
+				time.Sleep(time.Millisecond)
+			}
+			return rs.Write(msg, WriteOptions{Flush: true})
+		},
+		WithAppWorkerPool[string, string](WorkerPoolConfig{
+			Workers: int(n),
+			Mode:    WorkerPoolUnordered,
+		}))
+	assert.NoError(t, app.Start())
+	defer app.Stop()
+
+	rs := newTestIOSession(t)
+	defer rs.Close()
+	assert.NoError(t, rs.Connect(testUnixSocket, time.Second))
+	for i := int32(0); i < n; i++ {
+		assert.NoError(t, rs.Write("hello", WriteOptions{Flush: true}))
+	}
+	for i := int32(0); i < n; i++ {
+		reply, err := rs.Read(ReadOptions{Timeout: time.Second})
+		assert.NoError(t, err)
+		assert.Equal(t, "hello", reply)
+	}
+}
+
+func TestWorkerPoolBackpressure(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	for name, policy := range map[string]BackpressurePolicy{
+		"drop":  BackpressureDrop,
+		"close": BackpressureClose,
+	} {
+		bp := policy
+		t.Run(name, func(t *testing.T) {
+			// the first message blocks the only worker, the second is queued, and the third
+			// exceeds the queue
+			startedC := make(chan struct{})
+			releaseC := make(chan struct{})
+			app := newTestApp(t,
+				[]string{testUnixSocket},
+				func(rs IOSession[string, string], msg string, received uint64) error {
+					if received == 1 {
+						close(startedC)
+						<-releaseC
+					}
+					return rs.Write(msg, WriteOptions{Flush: true})
+				},
+				WithAppWorkerPool[string, string](WorkerPoolConfig{
+					Workers:      1,
+					QueueSize:    1,
+					Backpressure: bp,
+				}))
+			assert.NoError(t, app.Start())
+			defer app.Stop()
+
+			rs := newTestIOSession(t)
+			defer rs.Close()
+			assert.NoError(t, rs.Connect(testUnixSocket, time.Second))
+			assert.NoError(t, rs.Write("1", WriteOptions{Flush: true}))
+			<-startedC
+			assert.NoError(t, rs.Write("2", WriteOptions{Flush: true}))
+			assert.NoError(t, rs.Write("3", WriteOptions{Flush: true}))
+			time.Sleep(time.Millisecond * 50)
+			close(releaseC)
+
+			reply, err := rs.Read(ReadOptions{Timeout: time.Second})
+			assert.NoError(t, err)
+			assert.Equal(t, "1", reply)
+			if bp == BackpressureDrop {
+				reply, err = rs.Read(ReadOptions{Timeout: time.Second})
+				assert.NoError(t, err)
+				assert.Equal(t, "2", reply)
+				_, err = rs.Read(ReadOptions{Timeout: time.Millisecond * 100})
+				assert.Error(t, err)
+				return
+			}
+
+			// the queued message is skipped after the session closed
+			_, err = rs.Read(ReadOptions{Timeout: time.Second})
+			assert.Error(t, err)
+			assert.False(t, isTimeoutErr(err))
+		})
+	}
+}
+
+func isTimeoutErr(err error) bool {
+	ne, ok := err.(interface{ Timeout() bool })
+	return ok && ne.Timeout()
+}
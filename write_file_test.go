@@ -0,0 +1,130 @@
+package goetty
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fagongzi/goetty/v3/codec/simple"
+	"github.com/lni/goutils/leaktest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteFile(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	assert.NoError(t, os.RemoveAll(testUnixSocket[7:]))
+	app, err := NewApplicationWithListenAddress(testListenAddresses,
+		func(rs IOSession[[]byte, []byte], msg []byte, received uint64) error {
+			sum := sha256.Sum256(msg)
+			return rs.Write(sum[:], WriteOptions{Flush: true})
+		},
+		WithAppSessionOptions(WithSessionCodec(simple.NewBytesCodec())))
+	assert.NoError(t, err)
+	assert.NoError(t, app.Start())
+	defer app.Stop()
+
+	data := bytes.Repeat([]byte("0123456789abcdef"), defaultWriteFileChunkSize/8+1024)
+	f, err := os.Create(filepath.Join(t.TempDir(), "data"))
+	assert.NoError(t, err)
+	defer f.Close()
+	_, err = f.Write(data)
+	assert.NoError(t, err)
+
+	for name, address := range testAddresses {
+		addr := address
+		t.Run(name, func(t *testing.T) {
+			rs := NewIOSession(WithSessionCodec(simple.NewBytesCodec()))
+			defer rs.Close()
+			assert.NoError(t, rs.Connect(addr, time.Second))
+
+			// the length field is written into the out buffer, and flushed before the file
+			offset := int64(16)
+			n := int64(len(data)) - offset*2
+			rs.OutBuf().WriteInt(int(n))
+			var progress []int64
+			written, err := rs.(FileWriter).WriteFile(f, offset, n, WriteFileOptions{
+				Timeout: time.Second * 5,
+				Progress: func(written int64) {
+					progress = append(progress, written)
+				},
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, n, written)
+			assert.Equal(t, []int64{defaultWriteFileChunkSize, defaultWriteFileChunkSize * 2, n}, progress)
+
+			reply, err := rs.Read(ReadOptions{Timeout: time.Second * 5})
+			assert.NoError(t, err)
+			sum := sha256.Sum256(data[offset : offset+n])
+			assert.Equal(t, sum[:], reply)
+		})
+	}
+}
+
+func TestWriteFileAfterAsyncWrite(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	app := newTestApp(t, []string{testUnixSocket},
+		func(rs IOSession[string, string], msg string, received uint64) error {
+			return rs.Write(msg, WriteOptions{Flush: true})
+		})
+	assert.NoError(t, app.Start())
+	defer app.Stop()
+
+	// the file is a message encoded by the length field codec
+	f, err := os.Create(filepath.Join(t.TempDir(), "data"))
+	assert.NoError(t, err)
+	defer f.Close()
+	_, err = f.Write([]byte{0, 0, 0, 4, 'f', 'i', 'l', 'e'})
+	assert.NoError(t, err)
+
+	rs := newTestIOSession(t, WithSessionAsyncWrite[string, string](16))
+	defer rs.Close()
+	assert.NoError(t, rs.Connect(testUnixSocket, time.Second))
+
+	n := 100
+	for i := 0; i < n; i++ {
+		assert.NoError(t, rs.Write(fmt.Sprintf("%d", i), WriteOptions{}))
+	}
+	written, err := rs.(FileWriter).WriteFile(f, 0, 0, WriteFileOptions{Timeout: time.Second * 5})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(8), written)
+
+	for i := 0; i < n; i++ {
+		reply, err := rs.Read(ReadOptions{Timeout: time.Second * 5})
+		assert.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("%d", i), reply)
+	}
+	reply, err := rs.Read(ReadOptions{Timeout: time.Second * 5})
+	assert.NoError(t, err)
+	assert.Equal(t, "file", reply)
+}
+
+func TestWriteFileWithUnexpectedEOF(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	app := newTestApp(t, []string{testUnixSocket}, nil)
+	assert.NoError(t, app.Start())
+	defer app.Stop()
+
+	f, err := os.Create(filepath.Join(t.TempDir(), "data"))
+	assert.NoError(t, err)
+	defer f.Close()
+	_, err = f.Write([]byte("hello"))
+	assert.NoError(t, err)
+
+	rs := newTestIOSession(t)
+	defer rs.Close()
+	_, err = rs.(FileWriter).WriteFile(f, 0, 0, WriteFileOptions{})
+	assert.Equal(t, ErrIllegalState, err)
+
+	assert.NoError(t, rs.Connect(testUnixSocket, time.Second))
+	written, err := rs.(FileWriter).WriteFile(f, 0, 10, WriteFileOptions{})
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+	assert.Equal(t, int64(5), written)
+}